@@ -1,10 +1,9 @@
 package main
 
 import (
-	"encoding/json"
 	"github.com/BinaryHexer/nbw"
-	iox "github.com/BinaryHexer/nbw/pkg/io"
 	"github.com/BinaryHexer/nbw/pkg/stream"
+	"github.com/BinaryHexer/nbw/pkg/zapx"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"io"
@@ -19,10 +18,10 @@ func main() {
 	logger := newNonBlockingZapLogger(zapcore.DebugLevel, writer)
 
 	var wg sync.WaitGroup
+	wg.Add(3)
 
 	// all of these logs should be filtered out from the final output due to filterFunc.
 	go func() {
-		wg.Add(1)
 		for i := 0; i < 10; i++ {
 			iter := i
 			logger.Error("hello", zap.String("uuid", "ID001"), zap.Int("iter", iter))
@@ -32,7 +31,6 @@ func main() {
 
 	// all of these logs should be filtered out from the final output due to the groupFilterFunc.
 	go func() {
-		wg.Add(1)
 		for i := 0; i < 10; i++ {
 			iter := i
 			logger.Info("hello", zap.String("uuid", "ID002"), zap.Int("iter", iter))
@@ -42,7 +40,6 @@ func main() {
 
 	// all of these logs should be present in the final output due to last error log.
 	go func() {
-		wg.Add(1)
 		for i := 0; i < 10; i++ {
 			iter := i
 			logger.Info("hello", zap.String("uuid", "ID003"), zap.Int("iter", iter))
@@ -55,36 +52,15 @@ func main() {
 
 	time.Sleep(100 * time.Millisecond)
 	_ = logger.Sync()
+
+	// flush the pending groups
+	_ = writer.Close()
 }
 
 func basicFlow() (stream.MapFn, stream.FilterFn, stream.GroupFn, stream.GroupFilterFn) {
-	// extract metadata from logs
-	mapFn := func(i []byte) (stream.Metadata, []byte) {
-		var obj map[string]interface{}
-		md := make(stream.Metadata)
-
-		err := json.Unmarshal(i, &obj)
-		if err != nil {
-			return md, i
-		}
-
-		uuid, ok := obj["uuid"]
-		if !ok {
-			uuid = ""
-		}
-
-		level, ok := obj["level"]
-		if !ok {
-			level = ""
-		}
-
-		md = stream.Metadata{
-			"uuid":  uuid.(string),
-			"level": level.(string),
-		}
-
-		return md, i
-	}
+	// no need to extract metadata from logs, the zapx core hands the fields
+	// of each entry to the stream writer along with the encoded entry.
+	var mapFn stream.MapFn
 
 	// remove any logs with uuid ID001
 	filterFn := func(md stream.Metadata) bool {
@@ -121,9 +97,9 @@ func newNonBlockingZapLogger(lvl zapcore.Level, w io.Writer) *zap.Logger {
 	ec.EncodeDuration = zapcore.NanosDurationEncoder
 	ec.EncodeTime = zapcore.EpochNanosTimeEncoder
 	enc := zapcore.NewJSONEncoder(ec)
-	return zap.New(zapcore.NewCore(
+	return zap.New(zapx.NewCore(
 		enc,
-		iox.AddCloserSync(w),
+		w,
 		lvl,
 	))
 }
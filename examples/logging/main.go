@@ -2,6 +2,7 @@ package main
 
 import (
 	"github.com/BinaryHexer/nbw"
+	"github.com/BinaryHexer/nbw/pkg/zapx"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"io"
@@ -15,6 +16,10 @@ func main() {
 
 	logger.Info("hello world", zap.String("a", "1"))
 
+	// errors are written to stderr right away, bypassing the bundler
+	logger.Error("hello error", zap.String("a", "2"))
+
+	// drain the bundler
 	_ = logger.Sync()
 }
 
@@ -23,9 +28,10 @@ func newNonBlockingZapLogger(lvl zapcore.Level, w io.Writer) *zap.Logger {
 	ec.EncodeDuration = zapcore.NanosDurationEncoder
 	ec.EncodeTime = zapcore.EpochNanosTimeEncoder
 	enc := zapcore.NewJSONEncoder(ec)
-	return zap.New(zapcore.NewCore(
+	return zap.New(zapx.NewCore(
 		enc,
-		zapcore.AddSync(w),
+		w,
 		lvl,
+		zapx.WithDirect(zapcore.ErrorLevel, zapcore.Lock(os.Stderr)),
 	))
 }
@@ -2,41 +2,38 @@ package main
 
 import (
 	"github.com/BinaryHexer/nbw"
-	"github.com/reugn/go-streams/flow"
+	"github.com/BinaryHexer/nbw/pkg/stream"
+	"github.com/BinaryHexer/nbw/pkg/zapx"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
-	"golang.org/x/time/rate"
 	"io"
 	"os"
 	"time"
 )
 
 func main() {
-	limiter := rate.NewLimiter(rate.Every(time.Second/10), 1)
-	samplingFn := func(i interface{}) bool {
-		return limiter.Allow()
-	}
+	// per message: the first 5 logs of each second, then 1 out of 5
+	sampler := stream.NewSampler(nil, func(md stream.Metadata) string {
+		return md["msg"]
+	}, time.Second, 5, 5)
 
-	writer := nbw.NewStreamWriter(os.Stdout, flow.NewFilter(samplingFn, 1))
+	writer := nbw.NewStreamWriter(os.Stdout, sampler)
 	logger := newNonBlockingZapLogger(zapcore.InfoLevel, writer)
 
-	// 20 logs / sec - 50% sampling
-	for i := 0; i < 15; i++ {
+	// 20 logs / sec - sampled along with a summary of the suppressed logs
+	for i := 0; i < 20; i++ {
 		iter := i
 		logger.Info("hello world", zap.Int("iter", iter))
 		time.Sleep(50 * time.Millisecond)
 	}
 
-	time.Sleep(time.Second)
-
-	// 10 logs / sec - 0% sampling
-	for i := 15; i < 25; i++ {
+	// another message is sampled independently
+	for i := 0; i < 5; i++ {
 		iter := i
-		logger.Info("hello world", zap.Int("iter", iter))
-		time.Sleep(100 * time.Millisecond)
+		logger.Info("hello again", zap.Int("iter", iter))
 	}
 
-	_ = logger.Sync()
+	_ = writer.Close()
 }
 
 func newNonBlockingZapLogger(lvl zapcore.Level, w io.Writer) *zap.Logger {
@@ -44,9 +41,9 @@ func newNonBlockingZapLogger(lvl zapcore.Level, w io.Writer) *zap.Logger {
 	ec.EncodeDuration = zapcore.NanosDurationEncoder
 	ec.EncodeTime = zapcore.EpochNanosTimeEncoder
 	enc := zapcore.NewJSONEncoder(ec)
-	return zap.New(zapcore.NewCore(
+	return zap.New(zapx.NewCore(
 		enc,
-		zapcore.AddSync(w),
+		w,
 		lvl,
 	))
 }
@@ -5,13 +5,15 @@ go 1.15
 require (
 	code.cloudfoundry.org/go-diodes v0.0.0-20190809170250-f77fb823c7ee // indirect
 	github.com/cloudfoundry/go-diodes v0.0.0-20190809170250-f77fb823c7ee
+	github.com/klauspost/compress v1.11.0
 	github.com/ory/go-acc v0.2.6
 	github.com/quasilyte/go-consistent v0.0.0-20200404105227-766526bf1e96
 	github.com/reugn/go-streams v0.5.2
+	github.com/rs/zerolog v1.20.0
+	github.com/sirupsen/logrus v1.4.2
 	github.com/stretchr/testify v1.6.1
 	go.uber.org/multierr v1.5.0
 	go.uber.org/zap v1.16.0
-	golang.org/x/time v0.0.0-20191024005414-555d28b269f0
 	google.golang.org/api v0.34.0
 	mvdan.cc/gofumpt v0.0.0-20201129102820-5c11c50e9475
 )
@@ -5,10 +5,14 @@ import (
 	"io"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	bbi "github.com/BinaryHexer/nbw/internal/bundler"
+	"github.com/BinaryHexer/nbw/internal/segment"
 	bbx "github.com/BinaryHexer/nbw/pkg/bundler"
+	"github.com/BinaryHexer/nbw/pkg/compress"
+	iox "github.com/BinaryHexer/nbw/pkg/io"
 	"google.golang.org/api/support/bundler"
 )
 
@@ -79,8 +83,9 @@ func WithOnError(f func(err error)) WriterOption {
 	})
 }
 
-// WithErrorChannelCapacity sets the buffer capacity of errors channel.
-// The default is DefaultErrChanCapacity.
+// WithErrorChannelCapacity sets the buffer capacity of errors channel, the
+// errors reported while it is full are dropped so that writes never block on
+// the error handler. The default is DefaultErrChanCapacity.
 func WithErrorChannelCapacity(n int) WriterOption {
 	return WriterOption(func(bw *Writer) bbx.Option {
 		bw.errs = make(chan error, n)
@@ -89,13 +94,51 @@ func WithErrorChannelCapacity(n int) WriterOption {
 	})
 }
 
+// WithOverflowWriter sets the writer receiving the records rejected with
+// bundler.ErrOverflow once BufferedByteLimit is reached, e.g. a spill.Writer.
+// The default is to drop them. It is not used with a write-ahead log, which
+// keeps the records rejected until they are delivered.
+func WithOverflowWriter(w io.Writer) WriterOption {
+	return WriterOption(func(bw *Writer) bbx.Option {
+		bw.overflow = w
+
+		return nil
+	})
+}
+
+// WithCompression sets the codec compressing each bundle before it is written
+// to the underlying writer, as a single frame read back by compress.Reader.
+// The default is compress.None, the records are written one by one.
+func WithCompression(c compress.Codec) WriterOption {
+	return WriterOption(func(bw *Writer) bbx.Option {
+		bw.codec = c
+
+		return nil
+	})
+}
+
 // Writer is a io.Writer wrapper that uses a bundler to make Write lock-free,
 // non-blocking and thread safe.
 type Writer struct {
-	w       io.Writer
-	b       *bundler.Bundler
-	errs    chan error
-	onError func(err error)
+	// buffered counts the bytes held by the bundler, it comes first to be
+	// 64-bit aligned for atomic operations.
+	buffered int64
+
+	w        io.Writer
+	b        *bundler.Bundler
+	errs     chan error
+	onError  func(err error)
+	stop     chan struct{}
+	stopped  chan struct{}
+	started  *sync.Once
+	closed   *sync.Once
+	overflow io.Writer
+	codec    compress.Codec
+
+	wal           *wal
+	walOpts       []segment.Option
+	fsync         FsyncPolicy
+	fsyncInterval time.Duration
 }
 
 // NewWriter creates a writer wrapping w with a bundler in order to never block
@@ -118,6 +161,12 @@ func NewWriter(w io.Writer, opts []WriterOption) *Writer {
 		onError: func(err error) {
 			log.Printf("Dropped writes due to: %v", err)
 		},
+		stop:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+		started:       &sync.Once{},
+		closed:        &sync.Once{},
+		fsync:         DefaultFsyncPolicy,
+		fsyncInterval: DefaultFsyncInterval,
 	}
 
 	bOpts := bw.applyOpts(opts)
@@ -143,10 +192,13 @@ func (bw *Writer) applyOpts(opts []WriterOption) []bbx.Option {
 func (bw *Writer) newBundler(opts ...bbx.Option) *bundler.Bundler {
 	b := bbi.NewBundler(&[]byte{}, func(p interface{}) {
 		xs := p.([]*[]byte)
-		for _, x := range xs {
-			b := *x
-			bw.write(b)
+
+		if bw.wal != nil {
+			bw.handleWAL(xs)
+			return
 		}
+
+		bw.deliver(xs, false)
 	})
 
 	for _, o := range opts {
@@ -156,37 +208,134 @@ func (bw *Writer) newBundler(opts ...bbx.Option) *bundler.Bundler {
 	return b
 }
 
+// deliver writes the records of a bundle to the underlying writer and returns
+// the number of records done with, which are released. If stop is true, it
+// stops at the first record which could not be written, otherwise the records
+// which could not be written are dropped.
+func (bw *Writer) deliver(xs []*[]byte, stop bool) int {
+	if bw.codec != compress.None {
+		if !bw.writeFrame(xs) && stop {
+			return 0
+		}
+		bw.drop(xs)
+
+		return len(xs)
+	}
+
+	for i, x := range xs {
+		if !bw.write(*x) && stop {
+			return i
+		}
+		bw.drop(xs[i : i+1])
+	}
+
+	return len(xs)
+}
+
+// drop releases records which are no longer buffered.
+func (bw *Writer) drop(xs []*[]byte) {
+	for _, x := range xs {
+		atomic.AddInt64(&bw.buffered, -int64(len(*x)))
+		release(*x)
+	}
+}
+
 func (bw *Writer) Write(p []byte) (int, error) {
 	// copy slice here because byte buffer may changes before bundler flush the byte slice
 	// more memory allocations but it should be fast because write operation is non-blocking and slice copy is 60 ns/op operation
 	q := append(bufPool.Get().([]byte), p...)
 
+	if bw.wal != nil {
+		return bw.writeWAL(q)
+	}
+
 	// write to the bundler
 	if err := bw.b.Add(&q, len(q)); err != nil {
-		bw.error(fmt.Errorf(errWriteErr, err))
+		if err == bundler.ErrOverflow && bw.overflow != nil {
+			_, err = bw.overflow.Write(q)
+		}
+		if err != nil {
+			bw.error(fmt.Errorf(errWriteErr, err))
+		}
+	} else {
+		atomic.AddInt64(&bw.buffered, int64(len(q)))
 	}
 
 	return len(q), nil
 }
 
-func (bw *Writer) Close() error {
-	// flush the bundler
+// Sync flushes the bundler, syncs the write-ahead log if any and call Sync
+// on the wrapped writer if iox.WriteSyncer is implemented.
+func (bw *Writer) Sync() error {
 	bw.b.Flush()
 
-	// close if the underlying writer supports it
-	if w, ok := bw.w.(io.Closer); ok {
-		return w.Close()
+	if bw.wal != nil {
+		bw.drain()
+
+		if err := bw.wal.q.Sync(); err != nil {
+			return err
+		}
+	}
+
+	if w, ok := bw.w.(iox.WriteSyncer); ok {
+		return w.Sync()
 	}
 
 	return nil
 }
 
-func (bw *Writer) write(p []byte) {
+// Backpressure returns the share of BufferedByteLimit held by the bundler,
+// between 0 and 1.
+func (bw *Writer) Backpressure() float64 {
+	limit := bw.b.BufferedByteLimit
+	if limit <= 0 {
+		return 0
+	}
+
+	buffered := float64(atomic.LoadInt64(&bw.buffered))
+	if buffered >= float64(limit) {
+		return 1
+	}
+
+	return buffered / float64(limit)
+}
+
+func (bw *Writer) Close() error {
+	var err error
+
+	bw.closed.Do(func() {
+		// flush the bundler
+		bw.b.Flush()
+
+		if werr := bw.closeWAL(); werr != nil {
+			bw.error(fmt.Errorf(errWriteErr, werr))
+		}
+
+		// report the errors left, if the error handler was ever started
+		bw.started.Do(func() { close(bw.stopped) })
+		close(bw.stop)
+		<-bw.stopped
+
+		// close if the underlying writer supports it
+		if w, ok := bw.w.(io.Closer); ok {
+			err = w.Close()
+		}
+	})
+
+	return err
+}
+
+func (bw *Writer) write(p []byte) bool {
 	_, err := bw.w.Write(p)
 	if err != nil {
 		bw.error(fmt.Errorf(errWriteErr, err))
 	}
 
+	return err == nil
+}
+
+// release puts p back in the pool.
+func release(p []byte) {
 	// Proper usage of a sync.Pool requires each entry to have approximately
 	// the same memory cost. To obtain this property when the stored type
 	// contains a variably-sized buffer, we add a hard limit on the maximum buffer
@@ -200,15 +349,57 @@ func (bw *Writer) write(p []byte) {
 	}
 }
 
+// writeFrame compresses the records of a bundle into a single frame, on the
+// handler goroutine so that Write stays cheap.
+func (bw *Writer) writeFrame(xs []*[]byte) bool {
+	n := 0
+	for _, x := range xs {
+		n += len(*x)
+	}
+
+	bundle := make([]byte, 0, n)
+	for _, x := range xs {
+		bundle = append(bundle, *x...)
+	}
+
+	err := compress.WriteFrame(bw.w, bw.codec, bundle)
+	if err != nil {
+		bw.error(fmt.Errorf(errWriteErr, err))
+	}
+
+	return err == nil
+}
+
+// error hands err to the error handler, or drops it if the handler lags behind.
+// The error handler is started with the first error, so that a writer which
+// never fails holds no goroutine.
 func (bw *Writer) error(err error) {
-	bw.errs <- err
+	bw.started.Do(func() { go bw.handleErrors() })
+
+	select {
+	case bw.errs <- err:
+	default:
+	}
 }
 
-func (bw *Writer) handleErrors(err error) {
+// handleErrors calls onError with the reported errors until the writer is
+// closed.
+func (bw *Writer) handleErrors() {
+	defer close(bw.stopped)
+
 	for {
 		select {
-		case bw.errs <- err:
+		case err := <-bw.errs:
 			bw.onError(err)
+		case <-bw.stop:
+			for {
+				select {
+				case err := <-bw.errs:
+					bw.onError(err)
+				default:
+					return
+				}
+			}
 		}
 	}
 }
@@ -0,0 +1,285 @@
+package bundler
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/BinaryHexer/nbw/internal/segment"
+	abool "github.com/BinaryHexer/nbw/pkg/atomic"
+	bbx "github.com/BinaryHexer/nbw/pkg/bundler"
+	"google.golang.org/api/support/bundler"
+)
+
+const (
+	DefaultFsyncPolicy   = FsyncInterval
+	DefaultFsyncInterval = 100 * time.Millisecond
+)
+
+// FsyncPolicy tells when the write-ahead log is committed to stable storage.
+type FsyncPolicy int
+
+const (
+	// FsyncEveryRecord syncs the log before Write returns.
+	FsyncEveryRecord FsyncPolicy = iota
+	// FsyncInterval syncs the log periodically, see WithFsyncInterval.
+	FsyncInterval
+	// FsyncEveryBundle syncs the log before a bundle is written downstream.
+	FsyncEveryBundle
+)
+
+// WithFsyncPolicy sets when the write-ahead log is synced.
+// The default is DefaultFsyncPolicy.
+func WithFsyncPolicy(p FsyncPolicy) WriterOption {
+	return WriterOption(func(bw *Writer) bbx.Option {
+		bw.fsync = p
+
+		return nil
+	})
+}
+
+// WithFsyncInterval sets the interval at which the write-ahead log is synced
+// with FsyncInterval, and at which the records of the log which could not be
+// delivered are retried. The default is DefaultFsyncInterval.
+func WithFsyncInterval(d time.Duration) WriterOption {
+	return WriterOption(func(bw *Writer) bbx.Option {
+		bw.fsyncInterval = d
+
+		return nil
+	})
+}
+
+// WithWALMaxSize sets the maximum number of bytes kept in the write-ahead log,
+// Write fails once it is reached. The default is segment.DefaultMaxSize.
+func WithWALMaxSize(n int64) WriterOption {
+	return WriterOption(func(bw *Writer) bbx.Option {
+		bw.walOpts = append(bw.walOpts, segment.WithMaxSize(n))
+
+		return nil
+	})
+}
+
+type wal struct {
+	q    *segment.Queue
+	lock *sync.Mutex
+	// draining is set while the records at the head of the log are not held
+	// by the bundler, they are then delivered from the log by drain.
+	draining  *abool.Bool
+	drainLock *sync.Mutex
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// NewWALWriter creates a bundler writer which appends every record to a
+// write-ahead log stored in dir before Write returns. Records are removed
+// from the log once they are written downstream.
+//
+// Records left in dir by a previous process are replayed to w first, before
+// NewWALWriter returns.
+//
+//     wr, err := bundler.NewWALWriter(conn, "/var/lib/app/wal", []bundler.WriterOption{
+//         bundler.WithFsyncPolicy(bundler.FsyncEveryBundle),
+//     })
+//     if err != nil {
+//         return err
+//     }
+//     wr.Write([]byte("Hello, World!"))
+//
+// Delivery is at-least-once and in order: once a record could not be written
+// downstream, or the bundler overflowed, the records are delivered from the
+// log instead, starting with the failed one, until the log is caught up. The
+// log is retried at every fsync interval, on Sync and on Close, the records
+// still failing being kept for the next process.
+func NewWALWriter(w io.Writer, dir string, opts []WriterOption) (*Writer, error) {
+	bw := NewWriter(w, opts)
+
+	q, err := segment.Open(dir, bw.walOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	bw.wal = &wal{
+		q:         q,
+		lock:      &sync.Mutex{},
+		draining:  &abool.Bool{},
+		drainLock: &sync.Mutex{},
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	// replay the records left by a previous process
+	bw.wal.draining.Set(true)
+	bw.drain()
+
+	go bw.syncLoop()
+
+	return bw, nil
+}
+
+func (bw *Writer) writeWAL(p []byte) (int, error) {
+	bw.wal.lock.Lock()
+	defer bw.wal.lock.Unlock()
+
+	if err := bw.wal.q.Append(p); err != nil {
+		release(p)
+
+		return 0, err
+	}
+
+	if bw.fsync == FsyncEveryRecord {
+		if err := bw.wal.q.Sync(); err != nil {
+			bw.error(fmt.Errorf(errWriteErr, err))
+		}
+	}
+
+	if bw.wal.draining.Get() {
+		// the record is delivered from the log after the ones before it
+		release(p)
+
+		return len(p), nil
+	}
+
+	if err := bw.b.Add(&p, len(p)); err != nil {
+		// the record is only in the log, deliver the log from there on
+		bw.wal.draining.Set(true)
+		release(p)
+
+		if err != bundler.ErrOverflow {
+			bw.error(fmt.Errorf(errWriteErr, err))
+		}
+
+		return len(p), nil
+	}
+	atomic.AddInt64(&bw.buffered, int64(len(p)))
+
+	return len(p), nil
+}
+
+// handleWAL writes a bundle downstream and removes the records written from
+// the log. The records left, from the first one which could not be written,
+// stay at the head of the log and are delivered from there by drain.
+func (bw *Writer) handleWAL(xs []*[]byte) {
+	if bw.wal.draining.Get() {
+		// the records are delivered from the log
+		bw.drop(xs)
+
+		return
+	}
+
+	bw.syncWAL(FsyncEveryBundle)
+
+	n := bw.deliver(xs, true)
+	if n > 0 {
+		if err := bw.wal.q.Discard(n); err != nil {
+			// the records written may be delivered again from the log
+			bw.error(fmt.Errorf(errWriteErr, err))
+			bw.wal.draining.Set(true)
+		}
+	}
+
+	if n < len(xs) {
+		bw.wal.draining.Set(true)
+		bw.drop(xs[n:])
+	}
+}
+
+// drain delivers the records of the log, from its head, while the writer is
+// draining. Once the log is empty, the writer goes back to the bundler.
+func (bw *Writer) drain() {
+	w := bw.wal
+
+	w.drainLock.Lock()
+	defer w.drainLock.Unlock()
+
+	if !w.draining.Get() {
+		return
+	}
+
+	// the bundles in flight must not be handled while the log is read
+	bw.b.Flush()
+	if !bw.drainLog() {
+		return
+	}
+
+	// catch up with the records appended meanwhile, blocking the writes
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	bw.b.Flush()
+	if bw.drainLog() {
+		w.draining.Set(false)
+	}
+}
+
+// drainLog writes the records of the log downstream one by one, removing them
+// from the log, and reports whether the log is empty.
+func (bw *Writer) drainLog() bool {
+	for {
+		p, err := bw.wal.q.Peek()
+		if err == io.EOF {
+			return true
+		}
+		if err != nil {
+			bw.error(fmt.Errorf(errWriteErr, err))
+
+			return false
+		}
+
+		atomic.AddInt64(&bw.buffered, int64(len(p)))
+		if bw.deliver([]*[]byte{&p}, true) == 0 {
+			bw.drop([]*[]byte{&p})
+
+			return false
+		}
+
+		if err := bw.wal.q.Discard(1); err != nil {
+			bw.error(fmt.Errorf(errWriteErr, err))
+
+			return false
+		}
+	}
+}
+
+func (bw *Writer) syncWAL(policy FsyncPolicy) {
+	if bw.wal == nil || bw.fsync != policy {
+		return
+	}
+
+	if err := bw.wal.q.Sync(); err != nil {
+		bw.error(fmt.Errorf(errWriteErr, err))
+	}
+}
+
+func (bw *Writer) syncLoop() {
+	defer close(bw.wal.done)
+
+	t := time.NewTicker(bw.fsyncInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-bw.wal.stop:
+			return
+		case <-t.C:
+			bw.syncWAL(FsyncInterval)
+			bw.drain()
+		}
+	}
+}
+
+// closeWAL stops the periodic syncs, retries the records left and closes the
+// log, the records still not delivered are kept for the next process.
+func (bw *Writer) closeWAL() error {
+	if bw.wal == nil {
+		return nil
+	}
+
+	close(bw.wal.stop)
+	<-bw.wal.done
+
+	bw.drain()
+
+	return bw.wal.q.Close()
+}
@@ -4,10 +4,14 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cloudfoundry/go-diodes"
+
+	iox "github.com/BinaryHexer/nbw/pkg/io"
 )
 
 var (
@@ -18,8 +22,105 @@ var (
 	}
 )
 
+const (
+	DefaultShardPollInterval = 10 * time.Millisecond
+
+	// OtherShardKey gathers the stats of the keys of a ring beyond the first
+	// maxShardKeys ones.
+	OtherShardKey = "(other)"
+
+	maxShardKeys = 1024
+
+	// FNV-1a parameters, see hash/fnv.
+	offset32 = 2166136261
+	prime32  = 16777619
+)
+
 type Alerter func(missed int)
 
+// KeyFunc returns the key of the producer of a record, e.g. its component.
+type KeyFunc func(p []byte) string
+
+// WriterOption can be used to setup the writer.
+type WriterOption func(*Writer)
+
+// WithShards splits the diode into n rings of the full size each, the records
+// being spread over the rings by the hash of their key. The poller takes a
+// record from every ring in turn, so that a noisy producer only evicts the
+// records sharing its ring. If the poll interval is 0, DefaultShardPollInterval
+// is used. A single ring is used if n is lower than 2 or key is nil.
+func WithShards(n int, key KeyFunc) WriterOption {
+	return WriterOption(func(dw *Writer) {
+		dw.nshards = n
+		dw.key = key
+	})
+}
+
+// WithOverflowWriter sets the writer receiving the records which would
+// overwrite a record not consumed yet once the diode is full, e.g. the
+// Overflow writer of a spill.Writer. The default is to let the diode drop
+// the oldest records.
+func WithOverflowWriter(w io.Writer) WriterOption {
+	return WriterOption(func(dw *Writer) {
+		dw.overflow = w
+	})
+}
+
+// ShardStats describes a ring of a sharded diode.Writer. Keys lists the keys
+// routed to the ring, PerKey tells which of them had records dropped and
+// which of them evicted those records.
+type ShardStats struct {
+	Keys    []string
+	Written uint64
+	Dropped uint64
+	PerKey  map[string]KeyStats
+}
+
+// KeyStats describes the records of a key. Dropped counts the records evicted
+// before a later record of the key was written, and is exact once the ring is
+// drained, e.g. after Sync. Evicted counts the records of the key written
+// while the ring was full, i.e. the drops it triggered, whichever key the
+// records dropped belonged to.
+type KeyStats struct {
+	Written uint64
+	Dropped uint64
+	Evicted uint64
+}
+
+type shard struct {
+	// counters come first to be 64-bit aligned for atomic operations.
+	written  uint64
+	consumed uint64
+	dropped  uint64
+
+	d *diodes.ManyToOne
+
+	// keys is a map[string]*keyStats replaced on every new key under lock,
+	// so that Write looks the keys up without locking nor allocating.
+	keys atomic.Value
+	lock *sync.Mutex
+}
+
+type keyStats struct {
+	// counters come first to be 64-bit aligned for atomic operations.
+	written   uint64
+	delivered uint64
+	dropped   uint64
+	evicted   uint64
+
+	// last is the sequence of the last record of the key taken out of the
+	// ring, it is only used by the poller.
+	last uint64
+}
+
+// entry is a record of a sharded writer, tagged with its key and its sequence
+// among the records of the key so that the poller can attribute the drops.
+type entry struct {
+	key *keyStats
+	seq uint64
+	p   *[]byte
+}
+
 type diodeFetcher interface {
 	diodes.Diode
 	Next() diodes.GenericDataType
@@ -28,10 +129,23 @@ type diodeFetcher interface {
 // Writer is a io.Writer wrapper that uses a diode to make Write lock-free,
 // non-blocking and thread safe.
 type Writer struct {
+	// written and consumed count the writes set in and taken out (or dropped)
+	// of the diode, they come first to be 64-bit aligned for atomic operations.
+	written  uint64
+	consumed uint64
+
 	w    io.Writer
 	d    diodeFetcher
+	size int
 	c    context.CancelFunc
 	done chan struct{}
+
+	overflow io.Writer
+	nshards  int
+	key      KeyFunc
+	shards   []*shard
+	interval time.Duration
+	ctx      context.Context
 }
 
 // NewWriter creates a writer wrapping w with a many-to-one diode in order to
@@ -42,24 +156,36 @@ type Writer struct {
 //
 //     wr := diode.NewWriter(w, 1000, 0, func(missed int) {
 //         log.Printf("Dropped %d writes", missed)
-//     })
+//     }, nil)
 //     wr.Write([]byte("Hello, World!"))
 //
 // If pollInterval is greater than 0, a poller is used otherwise a waiter is
 // used.
 //
 // See code.cloudfoundry.org/go-diodes for more info on diode.
-func NewWriter(w io.Writer, size int, poolInterval time.Duration, f Alerter) *Writer {
+func NewWriter(w io.Writer, size int, poolInterval time.Duration, f Alerter, opts []WriterOption) *Writer {
 	ctx, cancel := context.WithCancel(context.Background())
 	dw := Writer{
 		w:    w,
+		size: size,
 		c:    cancel,
 		done: make(chan struct{}),
 	}
+	for _, o := range opts {
+		o(&dw)
+	}
 	if f == nil {
 		f = func(int) {}
 	}
-	d := diodes.NewManyToOne(size, diodes.AlertFunc(f))
+	if dw.nshards > 1 && dw.key != nil {
+		dw.shard(ctx, poolInterval, f)
+		go dw.pollShards()
+		return &dw
+	}
+	d := diodes.NewManyToOne(size, diodes.AlertFunc(func(missed int) {
+		atomic.AddUint64(&dw.consumed, uint64(missed))
+		f(missed)
+	}))
 	if poolInterval > 0 {
 		dw.d = diodes.NewPoller(
 			d,
@@ -76,13 +202,192 @@ func NewWriter(w io.Writer, size int, poolInterval time.Duration, f Alerter) *Wr
 	return &dw
 }
 
+func (dw *Writer) shard(ctx context.Context, pollInterval time.Duration, f Alerter) {
+	dw.ctx = ctx
+	dw.interval = pollInterval
+	if dw.interval <= 0 {
+		dw.interval = DefaultShardPollInterval
+	}
+
+	for i := 0; i < dw.nshards; i++ {
+		s := &shard{
+			lock: &sync.Mutex{},
+		}
+		s.keys.Store(make(map[string]*keyStats))
+		s.d = diodes.NewManyToOne(dw.size, diodes.AlertFunc(func(missed int) {
+			atomic.AddUint64(&s.dropped, uint64(missed))
+			atomic.AddUint64(&s.consumed, uint64(missed))
+			atomic.AddUint64(&dw.consumed, uint64(missed))
+			f(missed)
+		}))
+		dw.shards = append(dw.shards, s)
+	}
+}
+
 func (dw *Writer) Write(p []byte) (n int, err error) {
-	// p might be pooled so we avoid to hold a reference to it, and instead copy it.
-	p = append(bufPool.Get().([]byte), p...)
-	dw.d.Set(diodes.GenericDataType(&p))
+	if dw.shards != nil {
+		s, k := dw.shardOf(p)
+		if !dw.reserve(&s.written, &s.consumed) {
+			return dw.overflow.Write(p)
+		}
+		atomic.AddUint64(&dw.written, 1)
+		if w, c := atomic.LoadUint64(&s.written), atomic.LoadUint64(&s.consumed); w > c && w-c > uint64(dw.size) {
+			// the ring is full, the record overwrites one not consumed yet
+			atomic.AddUint64(&k.evicted, 1)
+		}
+		seq := atomic.AddUint64(&k.written, 1)
+		s.d.Set(diodes.GenericDataType(&entry{key: k, seq: seq, p: dw.copy(p)}))
+		return len(p), nil
+	}
+
+	if !dw.reserve(&dw.written, &dw.consumed) {
+		return dw.overflow.Write(p)
+	}
+	dw.d.Set(diodes.GenericDataType(dw.copy(p)))
 	return len(p), nil
 }
 
+// copy returns a pooled copy of p.
+func (dw *Writer) copy(p []byte) *[]byte {
+	// p might be pooled so we avoid to hold a reference to it, and instead copy it.
+	q := append(bufPool.Get().([]byte), p...)
+	return &q
+}
+
+// reserve counts a write in, unless an overflow writer is set and the diode
+// is full, in which case the record must go to the overflow writer.
+func (dw *Writer) reserve(written, consumed *uint64) bool {
+	n := atomic.AddUint64(written, 1)
+	if dw.overflow == nil {
+		return true
+	}
+
+	c := atomic.LoadUint64(consumed)
+	if n > c && n-c > uint64(dw.size) {
+		atomic.AddUint64(written, ^uint64(0))
+		return false
+	}
+	return true
+}
+
+// shardOf returns the ring of the key of p, by its FNV-1a hash, and the stats
+// of the key.
+func (dw *Writer) shardOf(p []byte) (*shard, *keyStats) {
+	key := dw.key(p)
+
+	h := uint32(offset32)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= prime32
+	}
+	s := dw.shards[h%uint32(len(dw.shards))]
+
+	if k, ok := s.keys.Load().(map[string]*keyStats)[key]; ok {
+		return s, k
+	}
+
+	return s, s.addKey(key)
+}
+
+// addKey returns the stats of a key seen for the first time, or of
+// OtherShardKey once the ring has maxShardKeys keys.
+func (s *shard) addKey(key string) *keyStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	keys := s.keys.Load().(map[string]*keyStats)
+	if k, ok := keys[key]; ok {
+		return k
+	}
+
+	if len(keys) >= maxShardKeys {
+		key = OtherShardKey
+		if k, ok := keys[key]; ok {
+			return k
+		}
+	}
+
+	next := make(map[string]*keyStats, len(keys)+1)
+	for name, k := range keys {
+		next[name] = k
+	}
+	k := &keyStats{}
+	next[key] = k
+	s.keys.Store(next)
+
+	return k
+}
+
+// Stats returns a snapshot of the rings of a sharded writer, nil otherwise.
+func (dw *Writer) Stats() []ShardStats {
+	var stats []ShardStats
+	for _, s := range dw.shards {
+		st := ShardStats{
+			Written: atomic.LoadUint64(&s.written),
+			Dropped: atomic.LoadUint64(&s.dropped),
+			PerKey:  make(map[string]KeyStats),
+		}
+		// the last records of a key may be dropped without a later one
+		// revealing it, so the drops are only exact once the ring is drained
+		drained := atomic.LoadUint64(&s.consumed) == st.Written
+		for name, k := range s.keys.Load().(map[string]*keyStats) {
+			ks := KeyStats{
+				Written: atomic.LoadUint64(&k.written),
+				Dropped: atomic.LoadUint64(&k.dropped),
+				Evicted: atomic.LoadUint64(&k.evicted),
+			}
+			if drained {
+				ks.Dropped = ks.Written - atomic.LoadUint64(&k.delivered)
+			}
+			st.Keys = append(st.Keys, name)
+			st.PerKey[name] = ks
+		}
+		sort.Strings(st.Keys)
+		stats = append(stats, st)
+	}
+	return stats
+}
+
+// Sync waits until every write made so far is either written to the wrapped
+// writer or dropped, then call Sync on the wrapped writer if iox.WriteSyncer
+// is implemented.
+func (dw *Writer) Sync() error {
+	target := atomic.LoadUint64(&dw.written)
+	for atomic.LoadUint64(&dw.consumed) < target {
+		select {
+		case <-dw.done:
+			return nil
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	if w, ok := dw.w.(iox.WriteSyncer); ok {
+		return w.Sync()
+	}
+	return nil
+}
+
+// Backpressure returns the share of the diode holding writes not consumed yet,
+// between 0 and 1. The share of the fullest ring is returned by a sharded
+// writer.
+func (dw *Writer) Backpressure() float64 {
+	if dw.shards != nil {
+		return dw.shardBackpressure()
+	}
+
+	consumed := atomic.LoadUint64(&dw.consumed)
+	written := atomic.LoadUint64(&dw.written)
+	if consumed >= written {
+		return 0
+	}
+
+	pending := float64(written - consumed)
+	if pending >= float64(dw.size) {
+		return 1
+	}
+	return pending / float64(dw.size)
+}
+
 // Close releases the diode poller and call Close on the wrapped writer if
 // io.Closer is implemented.
 func (dw *Writer) Close() error {
@@ -94,6 +399,67 @@ func (dw *Writer) Close() error {
 	return nil
 }
 
+func (dw *Writer) shardBackpressure() float64 {
+	max := 0.0
+	for _, s := range dw.shards {
+		consumed := atomic.LoadUint64(&s.consumed)
+		written := atomic.LoadUint64(&s.written)
+		if consumed >= written {
+			continue
+		}
+
+		pending := float64(written - consumed)
+		if pending >= float64(dw.size) {
+			return 1
+		}
+		if pending/float64(dw.size) > max {
+			max = pending / float64(dw.size)
+		}
+	}
+	return max
+}
+
+// pollShards takes a record from every ring in turn, and waits for the poll
+// interval once they are all empty. The rings are drained on Close.
+func (dw *Writer) pollShards() {
+	defer close(dw.done)
+	for {
+		empty := true
+		for _, s := range dw.shards {
+			if d, ok := s.d.TryNext(); ok {
+				// the slot is free once the record is taken out of the ring
+				atomic.AddUint64(&s.consumed, 1)
+				e := (*entry)(d)
+				e.key.deliver(e.seq)
+				dw.write(*e.p)
+				empty = false
+			}
+		}
+		if !empty {
+			continue
+		}
+
+		select {
+		case <-dw.ctx.Done():
+			return
+		case <-time.After(dw.interval):
+		}
+	}
+}
+
+// deliver counts a record of the key taken out of the ring, the gap with the
+// last one being the records dropped. The records may be set out of order by
+// concurrent producers, a late one is then no longer counted as dropped.
+func (k *keyStats) deliver(seq uint64) {
+	atomic.AddUint64(&k.delivered, 1)
+	if seq < k.last {
+		atomic.AddUint64(&k.dropped, ^uint64(0))
+		return
+	}
+	atomic.AddUint64(&k.dropped, seq-k.last-1)
+	k.last = seq
+}
+
 func (dw *Writer) poll() {
 	defer close(dw.done)
 	for {
@@ -101,21 +467,25 @@ func (dw *Writer) poll() {
 		if d == nil {
 			return
 		}
-		p := *(*[]byte)(d)
-		_, err := dw.w.Write(p)
-		if err != nil {
-			fmt.Printf("failed to write: %s\n", err.Error())
-		}
+		dw.write(*(*[]byte)(d))
+	}
+}
 
-		// Proper usage of a sync.Pool requires each entry to have approximately
-		// the same memory cost. To obtain this property when the stored type
-		// contains a variably-sized buffer, we add a hard limit on the maximum buffer
-		// to place back in the pool.
-		//
-		// See https://golang.org/issue/23199
-		const maxSize = 1 << 16 // 64KiB
-		if cap(p) <= maxSize {
-			bufPool.Put(p[:0])
-		}
+func (dw *Writer) write(p []byte) {
+	_, err := dw.w.Write(p)
+	if err != nil {
+		fmt.Printf("failed to write: %s\n", err.Error())
+	}
+	atomic.AddUint64(&dw.consumed, 1)
+
+	// Proper usage of a sync.Pool requires each entry to have approximately
+	// the same memory cost. To obtain this property when the stored type
+	// contains a variably-sized buffer, we add a hard limit on the maximum buffer
+	// to place back in the pool.
+	//
+	// See https://golang.org/issue/23199
+	const maxSize = 1 << 16 // 64KiB
+	if cap(p) <= maxSize {
+		bufPool.Put(p[:0])
 	}
 }
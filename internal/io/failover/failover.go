@@ -0,0 +1,246 @@
+package failover
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"go.uber.org/multierr"
+)
+
+const (
+	DefaultMaxFailures      = 3
+	DefaultLatencyThreshold = 0 // disabled
+	DefaultProbeInterval    = 5 * time.Second
+
+	Primary   = "primary"
+	Secondary = "secondary"
+)
+
+// Probe checks whether the primary sink is healthy again. A probe taking longer
+// than the latency threshold is considered failed.
+type Probe func(w io.Writer) error
+
+// WriterOption can be used to setup the writer.
+type WriterOption func(*Writer)
+
+// WithMaxFailures sets the number of consecutive failed writes after which the
+// writer switches to the secondary sink. The default is DefaultMaxFailures.
+func WithMaxFailures(n int) WriterOption {
+	return WriterOption(func(fw *Writer) {
+		fw.maxFailures = n
+	})
+}
+
+// WithLatencyThreshold sets the duration after which a successful write to the
+// primary sink is considered failed as well. Zero disables the latency check.
+// The default is DefaultLatencyThreshold.
+func WithLatencyThreshold(d time.Duration) WriterOption {
+	return WriterOption(func(fw *Writer) {
+		fw.latency = d
+	})
+}
+
+// WithProbeInterval sets the interval at which the primary sink is probed
+// while the secondary one is active. The default is DefaultProbeInterval.
+func WithProbeInterval(d time.Duration) WriterOption {
+	return WriterOption(func(fw *Writer) {
+		fw.interval = d
+	})
+}
+
+// WithProbe sets the health check of the primary sink.
+// The default is to send the next record to the primary sink once every probe
+// interval, and to fail back if it's written within the latency threshold.
+func WithProbe(p Probe) WriterOption {
+	return WriterOption(func(fw *Writer) {
+		fw.probe = p
+	})
+}
+
+// Stats describes the state of a failover.Writer.
+type Stats struct {
+	Active              string
+	ConsecutiveFailures int
+	Failovers           uint64
+	Failbacks           uint64
+}
+
+// Writer is a io.Writer sending the writes to a primary sink and switching to a
+// secondary sink when the primary one fails. The primary sink is probed in the
+// background and used again once healthy.
+type Writer struct {
+	primary     io.Writer
+	secondary   io.Writer
+	maxFailures int
+	latency     time.Duration
+	interval    time.Duration
+	probe       Probe
+
+	lock  *sync.Mutex
+	stats Stats
+	trial bool
+	stop  chan struct{}
+	done  chan struct{}
+	once  *sync.Once
+}
+
+// NewWriter creates a writer wrapping the primary and secondary sinks.
+// A record the primary sink fails to write is written to the secondary one.
+//
+// The writes are synchronous, use a failover.Writer below a diode, bundler or
+// stream writer so that failovers happen off the hot path
+//
+//     fw := failover.NewWriter(conn, file, []failover.WriterOption{failover.WithMaxFailures(5)})
+//     wr := bundler.NewWriter(fw, nil)
+//     wr.Write([]byte("Hello, World!"))
+func NewWriter(primary, secondary io.Writer, opts []WriterOption) *Writer {
+	fw := &Writer{
+		primary:     primary,
+		secondary:   secondary,
+		maxFailures: DefaultMaxFailures,
+		latency:     DefaultLatencyThreshold,
+		interval:    DefaultProbeInterval,
+		lock:        &sync.Mutex{},
+		stats:       Stats{Active: Primary},
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+		once:        &sync.Once{},
+	}
+
+	for _, o := range opts {
+		o(fw)
+	}
+
+	go fw.probeLoop()
+
+	return fw
+}
+
+func (fw *Writer) Write(p []byte) (int, error) {
+	fw.lock.Lock()
+	defer fw.lock.Unlock()
+
+	if fw.stats.Active == Secondary {
+		return fw.tryPrimary(p)
+	}
+
+	start := time.Now()
+	n, err := fw.primary.Write(p)
+	slow := fw.slow(start)
+
+	if err == nil && !slow {
+		fw.stats.ConsecutiveFailures = 0
+		return n, nil
+	}
+
+	fw.stats.ConsecutiveFailures++
+	if fw.stats.ConsecutiveFailures >= fw.maxFailures {
+		fw.stats.Active = Secondary
+		fw.stats.Failovers++
+	}
+
+	if err != nil {
+		return fw.secondary.Write(p)
+	}
+
+	return n, nil
+}
+
+// Stats returns a snapshot of the writer state.
+func (fw *Writer) Stats() Stats {
+	fw.lock.Lock()
+	defer fw.lock.Unlock()
+
+	return fw.stats
+}
+
+// Close stops the probes and call Close on both sinks if io.Closer is implemented.
+// Only the first call has an effect.
+func (fw *Writer) Close() error {
+	var err error
+
+	fw.once.Do(func() {
+		close(fw.stop)
+		<-fw.done
+
+		for _, w := range []io.Writer{fw.primary, fw.secondary} {
+			if c, ok := w.(io.Closer); ok {
+				err = multierr.Append(err, c.Close())
+			}
+		}
+	})
+
+	return err
+}
+
+func (fw *Writer) probeLoop() {
+	defer close(fw.done)
+
+	t := time.NewTicker(fw.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-fw.stop:
+			return
+		case <-t.C:
+			if fw.Stats().Active == Secondary {
+				fw.checkPrimary()
+			}
+		}
+	}
+}
+
+// checkPrimary runs the probe, or lets the next record try the primary sink
+// when no probe is set.
+func (fw *Writer) checkPrimary() {
+	if fw.probe == nil {
+		fw.lock.Lock()
+		fw.trial = true
+		fw.lock.Unlock()
+		return
+	}
+
+	start := time.Now()
+	if fw.probe(fw.primary) != nil || fw.slow(start) {
+		return
+	}
+
+	fw.lock.Lock()
+	fw.failback()
+	fw.lock.Unlock()
+}
+
+// tryPrimary writes p to the secondary sink, unless a trial is pending, in
+// which case p is written to the primary sink and the writer fails back if it
+// was written in time.
+func (fw *Writer) tryPrimary(p []byte) (int, error) {
+	if !fw.trial {
+		return fw.secondary.Write(p)
+	}
+	fw.trial = false
+
+	start := time.Now()
+	n, err := fw.primary.Write(p)
+	if err != nil {
+		return fw.secondary.Write(p)
+	}
+
+	if !fw.slow(start) {
+		fw.failback()
+	}
+
+	return n, nil
+}
+
+func (fw *Writer) slow(start time.Time) bool {
+	return fw.latency > 0 && time.Since(start) > fw.latency
+}
+
+// failback must be called with the lock held.
+func (fw *Writer) failback() {
+	fw.stats.Active = Primary
+	fw.stats.ConsecutiveFailures = 0
+	fw.stats.Failbacks++
+}
@@ -0,0 +1,206 @@
+package frame
+
+import (
+	"encoding/binary"
+	"io"
+	"sync/atomic"
+
+	iox "github.com/BinaryHexer/nbw/pkg/io"
+)
+
+const (
+	DefaultMaxRecordSize  = 0 // disabled
+	DefaultTruncateMarker = "...[truncated]"
+
+	lengthPrefixSize = 4
+)
+
+// OversizePolicy tells what happens to the records larger than the maximum size.
+type OversizePolicy int
+
+const (
+	// Truncate cuts the record and ends it with the truncate marker.
+	Truncate OversizePolicy = iota
+	// Drop discards the record.
+	Drop
+)
+
+// WriterOption can be used to setup the writer.
+type WriterOption func(*Writer)
+
+// WithNewline sets whether a newline is appended to the records lacking one.
+// The default is true.
+func WithNewline(enabled bool) WriterOption {
+	return WriterOption(func(fw *Writer) {
+		fw.newline = enabled
+	})
+}
+
+// WithLengthPrefix sets whether each record is prefixed with its length, as
+// a 4 bytes big endian integer, for binary transports. The default is false.
+func WithLengthPrefix(enabled bool) WriterOption {
+	return WriterOption(func(fw *Writer) {
+		fw.lengthPrefix = enabled
+	})
+}
+
+// WithMaxRecordSize sets the maximum size of a record in bytes, framing
+// excluded. Zero means unlimited. The default is DefaultMaxRecordSize.
+func WithMaxRecordSize(n int) WriterOption {
+	return WriterOption(func(fw *Writer) {
+		fw.maxSize = n
+	})
+}
+
+// WithOversizePolicy sets what happens to the records larger than the
+// maximum size. The default is Truncate.
+func WithOversizePolicy(p OversizePolicy) WriterOption {
+	return WriterOption(func(fw *Writer) {
+		fw.policy = p
+	})
+}
+
+// WithTruncateMarker sets the marker ending the truncated records.
+// The default is DefaultTruncateMarker.
+func WithTruncateMarker(marker string) WriterOption {
+	return WriterOption(func(fw *Writer) {
+		fw.marker = []byte(marker)
+	})
+}
+
+// Stats describes the records a frame.Writer had to alter.
+type Stats struct {
+	Truncated uint64
+	Dropped   uint64
+}
+
+// Writer is a io.Writer wrapper that frames every write as a single record,
+// so that downstream parsers never see a missing terminator or an
+// unbounded record.
+type Writer struct {
+	// counters come first to be 64-bit aligned for atomic operations.
+	truncated uint64
+	dropped   uint64
+
+	w            io.Writer
+	newline      bool
+	lengthPrefix bool
+	maxSize      int
+	policy       OversizePolicy
+	marker       []byte
+}
+
+// NewWriter creates a writer wrapping w. Each write is framed and passed to w
+// in a single write, as
+//
+//     | length (4 bytes, optional) | record (up to max size) | \n (if missing) |
+//
+// The length covers the record and its newline. A frame.Writer fits in front
+// of any of the writers of this module
+//
+//     opts := []frame.WriterOption{frame.WithMaxRecordSize(64 * 1024)}
+//     wr := frame.NewWriter(bundler.NewWriter(conn, nil), opts)
+//     wr.Write([]byte("Hello, World!"))
+func NewWriter(w io.Writer, opts []WriterOption) *Writer {
+	fw := &Writer{
+		w:       w,
+		newline: true,
+		maxSize: DefaultMaxRecordSize,
+		policy:  Truncate,
+		marker:  []byte(DefaultTruncateMarker),
+	}
+
+	for _, o := range opts {
+		o(fw)
+	}
+
+	return fw
+}
+
+func (fw *Writer) Write(p []byte) (int, error) {
+	// empty writes, e.g. health checks, are not records
+	if len(p) == 0 {
+		return fw.w.Write(p)
+	}
+
+	record := p
+	if fw.newline && record[len(record)-1] == '\n' {
+		record = record[:len(record)-1]
+	}
+
+	var truncated bool
+	if fw.maxSize > 0 && len(record) > fw.maxSize {
+		if fw.policy == Drop {
+			atomic.AddUint64(&fw.dropped, 1)
+			return len(p), nil
+		}
+
+		atomic.AddUint64(&fw.truncated, 1)
+		truncated = true
+		record = record[:fw.cut()]
+	}
+
+	n := len(record)
+	if truncated {
+		n += len(fw.marker)
+	}
+	if fw.newline {
+		n++
+	}
+
+	buf := make([]byte, 0, lengthPrefixSize+n)
+	if fw.lengthPrefix {
+		var prefix [lengthPrefixSize]byte
+		binary.BigEndian.PutUint32(prefix[:], uint32(n))
+		buf = append(buf, prefix[:]...)
+	}
+	buf = append(buf, record...)
+	if truncated {
+		buf = append(buf, fw.marker...)
+	}
+	if fw.newline {
+		buf = append(buf, '\n')
+	}
+
+	if _, err := fw.w.Write(buf); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// cut returns the length of the records kept when truncating, so that the
+// record and the marker fit in the maximum size.
+func (fw *Writer) cut() int {
+	if len(fw.marker) >= fw.maxSize {
+		return 0
+	}
+
+	return fw.maxSize - len(fw.marker)
+}
+
+// Stats returns a snapshot of the writer counters.
+func (fw *Writer) Stats() Stats {
+	return Stats{
+		Truncated: atomic.LoadUint64(&fw.truncated),
+		Dropped:   atomic.LoadUint64(&fw.dropped),
+	}
+}
+
+// Sync calls Sync on the wrapped writer if iox.WriteSyncer is implemented.
+func (fw *Writer) Sync() error {
+	if w, ok := fw.w.(iox.WriteSyncer); ok {
+		return w.Sync()
+	}
+
+	return nil
+}
+
+// Close calls Close on the wrapped writer if io.Closer is implemented.
+func (fw *Writer) Close() error {
+	if w, ok := fw.w.(io.Closer); ok {
+		return w.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package multi
+
+import (
+	"io"
+
+	"go.uber.org/multierr"
+)
+
+// Writer is a io.Writer duplicating its writes to several writers.
+// Contrary to io.MultiWriter, every write is handed to all the writers even
+// if some of them fail.
+type Writer struct {
+	ws []io.WriteCloser
+}
+
+// NewWriter creates a writer duplicating its writes to every sink, each one
+// wrapped by wrap in its own non-blocking writer, so that a slow sink doesn't
+// stall the others.
+//
+// Use a multi.Writer when
+//
+//     wr := multi.NewWriter(func(w io.Writer) io.WriteCloser {
+//         return diode.NewWriter(w, 1000, 0, nil, nil)
+//     }, file, conn)
+//     wr.Write([]byte("Hello, World!"))
+func NewWriter(wrap func(io.Writer) io.WriteCloser, sinks []io.Writer) *Writer {
+	ws := make([]io.WriteCloser, len(sinks))
+	for idx, s := range sinks {
+		ws[idx] = wrap(s)
+	}
+
+	return &Writer{ws: ws}
+}
+
+func (mw *Writer) Write(p []byte) (int, error) {
+	var err error
+
+	for _, w := range mw.ws {
+		_, e := w.Write(p)
+		err = multierr.Append(err, e)
+	}
+
+	return len(p), err
+}
+
+// Close calls Close on every wrapped writer.
+func (mw *Writer) Close() error {
+	var err error
+
+	for _, w := range mw.ws {
+		err = multierr.Append(err, w.Close())
+	}
+
+	return err
+}
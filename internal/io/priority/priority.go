@@ -0,0 +1,279 @@
+package priority
+
+import (
+	"errors"
+	"io"
+	"log"
+	"sync"
+
+	"github.com/BinaryHexer/nbw/internal/io/shed"
+	"github.com/BinaryHexer/nbw/pkg/stream"
+)
+
+// OverflowPolicy tells which record is dropped when a lane is full.
+type OverflowPolicy int
+
+const (
+	// DropNewest drops the incoming record.
+	DropNewest OverflowPolicy = iota
+	// DropOldest drops the oldest record of the lane to make room.
+	DropOldest
+)
+
+//nolint:gochecknoglobals  // necessary to maintain the default lanes and errors
+var (
+	DefaultLanes = []Lane{
+		{Name: "high", Levels: []string{"error", "dpanic", "panic", "fatal"}, Capacity: 1000, Weight: 8, Overflow: DropNewest},
+		{Name: "normal", Levels: []string{"warn", "warning", "info"}, Capacity: 1000, Weight: 4, Overflow: DropOldest},
+		{Name: "low", Levels: []string{"debug", "trace"}, Capacity: 1000, Weight: 1, Overflow: DropOldest},
+	}
+
+	errClosed = errors.New("writer already closed")
+)
+
+// Lane is a queue holding the records of some levels.
+//
+// Capacity is the number of records it holds before applying its overflow
+// policy and Weight the number of records drained from it per round.
+type Lane struct {
+	Name     string
+	Levels   []string
+	Capacity int
+	Weight   int
+	Overflow OverflowPolicy
+}
+
+// Stats describes the state of a lane.
+type Stats struct {
+	Queued  int
+	Dropped uint64
+}
+
+// WriterOption can be used to setup the writer.
+type WriterOption func(*Writer)
+
+// WithLanes sets the lanes, from the highest priority to the lowest. Records
+// whose level matches no lane go to the last one. The default, also used when
+// no lane is given, is DefaultLanes.
+func WithLanes(lanes ...Lane) WriterOption {
+	return WriterOption(func(pw *Writer) {
+		pw.lanes = lanes
+	})
+}
+
+// WithClassifier sets the function returning the level of the records written
+// with Write. The default reads the "level" field of JSON records, see
+// shed.JSONLevel.
+func WithClassifier(fn shed.LevelFunc) WriterOption {
+	return WriterOption(func(pw *Writer) {
+		pw.classify = fn
+	})
+}
+
+// WithOnError sets the function to be executed on errors.
+// The default is a simple log.
+func WithOnError(f func(err error)) WriterOption {
+	return WriterOption(func(pw *Writer) {
+		pw.onError = f
+	})
+}
+
+type queue struct {
+	Lane
+	records [][]byte
+	dropped uint64
+}
+
+// Writer is a io.Writer queueing the records in priority lanes, drained by a
+// background goroutine with weighted round robin into the wrapped writer, so
+// that a flood of low severity records never evicts nor starves the errors.
+type Writer struct {
+	w        io.Writer
+	lanes    []Lane
+	classify shed.LevelFunc
+	onError  func(err error)
+
+	queues []*queue
+	levels map[string]*queue
+	lock   *sync.Mutex
+	ready  *sync.Cond
+	closed bool
+	done   chan struct{}
+}
+
+// NewWriter creates a writer wrapping w. Write and WriteRecord never block
+// on w, records are dropped according to the policy of their lane instead.
+//
+//     wr := priority.NewWriter(conn, []priority.WriterOption{priority.WithLanes(
+//         priority.Lane{Name: "errors", Levels: []string{"error"}, Capacity: 100, Weight: 10},
+//         priority.Lane{Name: "others", Capacity: 10000, Weight: 1, Overflow: priority.DropOldest},
+//     )})
+//     wr.Write([]byte(`{"level":"error","msg":"Hello, World!"}`))
+//
+// WriteRecord uses the "level" metadata, as set by the logger integrations,
+// instead of calling the classifier.
+func NewWriter(w io.Writer, opts []WriterOption) *Writer {
+	pw := &Writer{
+		w:        w,
+		lanes:    DefaultLanes,
+		classify: shed.JSONLevel,
+		levels:   make(map[string]*queue),
+		lock:     &sync.Mutex{},
+		done:     make(chan struct{}),
+		onError: func(err error) {
+			log.Printf("err occurred: %v\n", err)
+		},
+	}
+	pw.ready = sync.NewCond(pw.lock)
+
+	for _, o := range opts {
+		o(pw)
+	}
+
+	if len(pw.lanes) == 0 {
+		pw.lanes = DefaultLanes
+	}
+
+	for _, l := range pw.lanes {
+		if l.Weight < 1 {
+			l.Weight = 1
+		}
+		if l.Capacity < 1 {
+			l.Capacity = 1
+		}
+
+		q := &queue{Lane: l}
+		pw.queues = append(pw.queues, q)
+
+		for _, level := range l.Levels {
+			if _, ok := pw.levels[level]; !ok {
+				pw.levels[level] = q
+			}
+		}
+	}
+
+	go pw.drain()
+
+	return pw
+}
+
+func (pw *Writer) Write(p []byte) (int, error) {
+	return pw.enqueue(pw.classify(p), p)
+}
+
+// WriteRecord writes p in the lane of the "level" metadata.
+func (pw *Writer) WriteRecord(md stream.Metadata, p []byte) (int, error) {
+	return pw.enqueue(md["level"], p)
+}
+
+func (pw *Writer) enqueue(level string, p []byte) (int, error) {
+	pw.lock.Lock()
+	defer pw.lock.Unlock()
+
+	if pw.closed {
+		return 0, errClosed
+	}
+
+	q, ok := pw.levels[level]
+	if !ok {
+		q = pw.queues[len(pw.queues)-1]
+	}
+
+	if len(q.records) >= q.Capacity {
+		q.dropped++
+		if q.Overflow == DropNewest {
+			return len(p), nil
+		}
+		q.records[0] = nil
+		q.records = q.records[1:]
+	}
+
+	q.records = append(q.records, append([]byte(nil), p...))
+	pw.ready.Signal()
+
+	return len(p), nil
+}
+
+// Stats returns a snapshot of the lanes, by name.
+func (pw *Writer) Stats() map[string]Stats {
+	pw.lock.Lock()
+	defer pw.lock.Unlock()
+
+	stats := make(map[string]Stats, len(pw.queues))
+	for _, q := range pw.queues {
+		stats[q.Name] = Stats{Queued: len(q.records), Dropped: q.dropped}
+	}
+
+	return stats
+}
+
+// Close drains the lanes and call Close on the wrapped writer if io.Closer
+// is implemented.
+func (pw *Writer) Close() error {
+	pw.lock.Lock()
+	pw.closed = true
+	pw.ready.Signal()
+	pw.lock.Unlock()
+
+	<-pw.done
+
+	if w, ok := pw.w.(io.Closer); ok {
+		return w.Close()
+	}
+
+	return nil
+}
+
+func (pw *Writer) drain() {
+	defer close(pw.done)
+
+	for {
+		batch, ok := pw.next()
+		if !ok {
+			return
+		}
+
+		for _, p := range batch {
+			if _, err := pw.w.Write(p); err != nil {
+				pw.onError(err)
+			}
+		}
+	}
+}
+
+// next waits for records and returns a round of them: up to Weight records of
+// every lane, from the highest priority to the lowest. ok is false once the
+// writer is closed and drained.
+func (pw *Writer) next() (batch [][]byte, ok bool) {
+	pw.lock.Lock()
+	defer pw.lock.Unlock()
+
+	for pw.empty() {
+		if pw.closed {
+			return nil, false
+		}
+		pw.ready.Wait()
+	}
+
+	for _, q := range pw.queues {
+		n := q.Weight
+		if n > len(q.records) {
+			n = len(q.records)
+		}
+
+		batch = append(batch, q.records[:n]...)
+		q.records = q.records[n:]
+	}
+
+	return batch, true
+}
+
+func (pw *Writer) empty() bool {
+	for _, q := range pw.queues {
+		if len(q.records) > 0 {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,56 @@
+package redact
+
+import (
+	"io"
+
+	iox "github.com/BinaryHexer/nbw/pkg/io"
+	"github.com/BinaryHexer/nbw/pkg/stream"
+)
+
+// Writer is a io.Writer wrapper scrubbing sensitive data from the records
+// before they reach the wrapped writer.
+type Writer struct {
+	w io.Writer
+	r *stream.Scrubber
+}
+
+// NewWriter creates a writer wrapping w which scrubs the records with r.
+//
+// Redaction happens on the caller goroutine, use a redact.Writer in front of
+// a diode or bundler writer so that no sensitive data is ever buffered
+//
+//     r := stream.NewScrubber(stream.WithRedactPattern(stream.EmailPattern, stream.RedactMask))
+//     wr := redact.NewWriter(bundler.NewWriter(conn, nil), r)
+//     wr.Write([]byte(`{"msg":"sent to a@b.co"}`))
+func NewWriter(w io.Writer, r *stream.Scrubber) *Writer {
+	return &Writer{
+		w: w,
+		r: r,
+	}
+}
+
+func (rw *Writer) Write(p []byte) (int, error) {
+	if _, err := rw.w.Write(rw.r.Redact(p)); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Sync calls Sync on the wrapped writer if iox.WriteSyncer is implemented.
+func (rw *Writer) Sync() error {
+	if w, ok := rw.w.(iox.WriteSyncer); ok {
+		return w.Sync()
+	}
+
+	return nil
+}
+
+// Close calls Close on the wrapped writer if io.Closer is implemented.
+func (rw *Writer) Close() error {
+	if w, ok := rw.w.(io.Closer); ok {
+		return w.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package retry
+
+import (
+	"io"
+
+	rtx "github.com/BinaryHexer/nbw/pkg/retry"
+)
+
+// Writer is a io.Writer wrapper that retries failed writes according to a
+// retry.Policy and hands the records that finally failed to a dead-letter
+// writer.
+type Writer struct {
+	w          io.Writer
+	p          rtx.Policy
+	deadLetter io.Writer
+}
+
+// NewWriter creates a writer wrapping w that retries every failed write using p.
+// After a short write, only the bytes not accepted yet are retried. The bytes
+// that still fail after the last attempt are written to deadLetter, if not
+// nil, and the write error is returned to the caller.
+//
+// Writer is meant to be wrapped by a diode, bundler or stream writer, so that
+// the retries happen on their background goroutine and never block the producers.
+//
+//     rw := retry.NewWriter(conn, rtx.DefaultPolicy(), deadLetterFile)
+//     wr := diode.NewWriter(rw, 1000, 0, nil, nil)
+//     wr.Write([]byte("Hello, World!"))
+func NewWriter(w io.Writer, p rtx.Policy, deadLetter io.Writer) *Writer {
+	return &Writer{
+		w:          w,
+		p:          p,
+		deadLetter: deadLetter,
+	}
+}
+
+func (rw *Writer) Write(p []byte) (int, error) {
+	written := 0
+	err := rw.p.Do(func() error {
+		n, err := rw.w.Write(p[written:])
+		if n > 0 {
+			written += n
+		}
+		if written > len(p) {
+			written = len(p)
+		}
+		if err == nil && written < len(p) {
+			err = io.ErrShortWrite
+		}
+
+		return err
+	})
+
+	if err != nil && rw.deadLetter != nil {
+		_, _ = rw.deadLetter.Write(p[written:])
+	}
+
+	return written, err
+}
+
+// Close calls Close on the wrapped writer if io.Closer is implemented.
+// The dead-letter writer is left open as it is owned by the caller.
+func (rw *Writer) Close() error {
+	if w, ok := rw.w.(io.Closer); ok {
+		return w.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,254 @@
+package shed
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"sync/atomic"
+
+	iox "github.com/BinaryHexer/nbw/pkg/io"
+)
+
+const (
+	DefaultDebugThreshold = 0.5
+	DefaultInfoThreshold  = 0.8
+	DefaultHysteresis     = 0.2
+)
+
+// LevelFunc returns the severity of a record, e.g. "debug" or "info".
+type LevelFunc func(p []byte) string
+
+// WriterOption can be used to setup the writer.
+type WriterOption func(*Writer)
+
+// WithThreshold sets the backpressure, between 0 and 1, from which the records
+// of the given level are dropped. The defaults are DefaultDebugThreshold for
+// debug and DefaultInfoThreshold for info, other levels are never dropped.
+func WithThreshold(level string, pressure float64) WriterOption {
+	return WriterOption(func(sw *Writer) {
+		sw.thresholds[level] = pressure
+	})
+}
+
+// WithHysteresis sets how far below its threshold the backpressure must fall
+// before a level is let through again. The default is DefaultHysteresis.
+func WithHysteresis(h float64) WriterOption {
+	return WriterOption(func(sw *Writer) {
+		sw.hysteresis = h
+	})
+}
+
+// WithLevelFunc sets the function extracting the level of the records.
+// The default reads the "level" field of JSON records, see JSONLevel.
+func WithLevelFunc(fn LevelFunc) WriterOption {
+	return WriterOption(func(sw *Writer) {
+		sw.levelF = fn
+	})
+}
+
+// WithBackpressurer sets the source of the backpressure.
+// The default is the wrapped writer if it implements iox.Backpressurer.
+func WithBackpressurer(bp iox.Backpressurer) WriterOption {
+	return WriterOption(func(sw *Writer) {
+		sw.bp = bp
+	})
+}
+
+// Stats describes the state of a shed.Writer.
+type Stats struct {
+	Pressure float64
+	Shedding []string
+	Dropped  map[string]uint64
+}
+
+type level struct {
+	threshold float64
+	shedding  int32
+	dropped   uint64
+}
+
+// Writer is a io.Writer wrapper that drops the low severity records while the
+// wrapped non-blocking writer falls behind, so that the errors keep flowing.
+type Writer struct {
+	w          io.Writer
+	bp         iox.Backpressurer
+	thresholds map[string]float64
+	hysteresis float64
+	levelF     LevelFunc
+	levels     map[string]*level
+}
+
+// NewWriter creates a writer wrapping w, usually a diode or bundler writer.
+// Every write reads the backpressure of w and updates the levels being shed:
+// a level is dropped once the backpressure reaches its threshold and let
+// through again once it falls below the threshold minus the hysteresis.
+//
+//     bw := bundler.NewWriter(conn, nil)
+//     wr := shed.NewWriter(bw, []shed.WriterOption{shed.WithThreshold("info", 0.9)})
+//     wr.Write([]byte(`{"level":"debug","msg":"Hello, World!"}`))
+//
+// Nothing is dropped if w does not implement iox.Backpressurer and no other
+// source is set with WithBackpressurer.
+func NewWriter(w io.Writer, opts []WriterOption) *Writer {
+	sw := &Writer{
+		w: w,
+		thresholds: map[string]float64{
+			"debug": DefaultDebugThreshold,
+			"info":  DefaultInfoThreshold,
+		},
+		hysteresis: DefaultHysteresis,
+		levelF:     JSONLevel,
+	}
+
+	if bp, ok := w.(iox.Backpressurer); ok {
+		sw.bp = bp
+	}
+
+	for _, o := range opts {
+		o(sw)
+	}
+
+	sw.levels = make(map[string]*level, len(sw.thresholds))
+	for l, t := range sw.thresholds {
+		sw.levels[l] = &level{threshold: t}
+	}
+
+	return sw
+}
+
+func (sw *Writer) Write(p []byte) (int, error) {
+	if sw.bp == nil {
+		return sw.w.Write(p)
+	}
+
+	pressure := sw.bp.Backpressure()
+	for _, l := range sw.levels {
+		sw.update(l, pressure)
+	}
+
+	if l, ok := sw.levels[sw.levelF(p)]; ok && atomic.LoadInt32(&l.shedding) == 1 {
+		atomic.AddUint64(&l.dropped, 1)
+		return len(p), nil
+	}
+
+	return sw.w.Write(p)
+}
+
+func (sw *Writer) update(l *level, pressure float64) {
+	switch {
+	case pressure >= l.threshold:
+		atomic.StoreInt32(&l.shedding, 1)
+	case pressure < l.threshold-sw.hysteresis:
+		atomic.StoreInt32(&l.shedding, 0)
+	}
+}
+
+// Stats returns a snapshot of the writer state.
+func (sw *Writer) Stats() Stats {
+	s := Stats{Dropped: make(map[string]uint64, len(sw.levels))}
+	if sw.bp != nil {
+		s.Pressure = sw.bp.Backpressure()
+	}
+
+	for name, l := range sw.levels {
+		if atomic.LoadInt32(&l.shedding) == 1 {
+			s.Shedding = append(s.Shedding, name)
+		}
+		s.Dropped[name] = atomic.LoadUint64(&l.dropped)
+	}
+	sort.Strings(s.Shedding)
+
+	return s
+}
+
+// Sync calls Sync on the wrapped writer if iox.WriteSyncer is implemented.
+func (sw *Writer) Sync() error {
+	if w, ok := sw.w.(iox.WriteSyncer); ok {
+		return w.Sync()
+	}
+
+	return nil
+}
+
+// Close calls Close on the wrapped writer if io.Closer is implemented.
+func (sw *Writer) Close() error {
+	if w, ok := sw.w.(io.Closer); ok {
+		return w.Close()
+	}
+
+	return nil
+}
+
+// JSONLevel returns the value of the top level "level" string field of a JSON
+// record, as written by zap, zerolog, logrus and slog, lower cased. The fields
+// of nested objects are skipped. It does not decode the record.
+func JSONLevel(p []byte) string {
+	depth := 0
+	// key is true when the next string of the top level object is a key
+	key := false
+
+	for i := 0; i < len(p); i++ {
+		switch p[i] {
+		case '{':
+			depth++
+			key = depth == 1
+		case '[':
+			depth++
+		case '}', ']':
+			depth--
+		case ',':
+			key = depth == 1
+		case '"':
+			end := stringEnd(p, i+1)
+			if end < 0 {
+				return ""
+			}
+
+			if key && depth == 1 {
+				key = false
+				if string(p[i+1:end]) == "level" {
+					return levelValue(p[end+1:])
+				}
+			}
+			i = end
+		}
+	}
+
+	return ""
+}
+
+// levelValue returns the string value following a key, or "" if the value is
+// not a string.
+func levelValue(p []byte) string {
+	p = bytes.TrimLeft(p, " \t\r\n")
+	if len(p) == 0 || p[0] != ':' {
+		return ""
+	}
+
+	p = bytes.TrimLeft(p[1:], " \t\r\n")
+	if len(p) == 0 || p[0] != '"' {
+		return ""
+	}
+
+	end := stringEnd(p, 1)
+	if end < 0 {
+		return ""
+	}
+
+	return string(bytes.ToLower(p[1:end]))
+}
+
+// stringEnd returns the index of the quote closing the JSON string starting
+// at p[i], or -1.
+func stringEnd(p []byte, i int) int {
+	for ; i < len(p); i++ {
+		switch p[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+
+	return -1
+}
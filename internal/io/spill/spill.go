@@ -0,0 +1,247 @@
+package spill
+
+import (
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/BinaryHexer/nbw/internal/segment"
+)
+
+const (
+	DefaultReplayInterval = time.Second
+)
+
+// WriterOption can be used to setup the writer.
+type WriterOption func(*Writer) segment.Option
+
+// WithSegmentSize sets the size (in bytes) after which a new segment file is started.
+// The default is segment.DefaultSegmentSize.
+func WithSegmentSize(n int64) WriterOption {
+	return WriterOption(func(sw *Writer) segment.Option {
+		return segment.WithSegmentSize(n)
+	})
+}
+
+// WithMaxSize sets the maximum number of bytes kept on disk. Records spilled
+// once the limit is reached are dropped. The default is segment.DefaultMaxSize.
+func WithMaxSize(n int64) WriterOption {
+	return WriterOption(func(sw *Writer) segment.Option {
+		return segment.WithMaxSize(n)
+	})
+}
+
+// WithReplayInterval sets the interval at which the spilled records are replayed
+// to the underlying writer. The default is DefaultReplayInterval.
+func WithReplayInterval(d time.Duration) WriterOption {
+	return WriterOption(func(sw *Writer) segment.Option {
+		sw.interval = d
+
+		return nil
+	})
+}
+
+// WithOnError sets the function to be executed on errors.
+// The default is a simple log.
+func WithOnError(f func(err error)) WriterOption {
+	return WriterOption(func(sw *Writer) segment.Option {
+		sw.onError = f
+
+		return nil
+	})
+}
+
+// Writer is a io.Writer wrapper that spills the records the underlying writer
+// fails to accept into a disk-backed queue, and replays them in order once the
+// underlying writer recovers or the process restarts.
+type Writer struct {
+	w        io.Writer
+	q        *segment.Queue
+	interval time.Duration
+	onError  func(err error)
+
+	lock *sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewWriter creates a writer wrapping w which spills into segment files stored in dir.
+// Records left in dir by a previous process are replayed first.
+//
+// Use a spill.Writer below a diode, bundler or stream writer to get
+// at-least-once delivery without blocking the producers
+//
+//     sw, err := spill.NewWriter(conn, "/var/spool/app", nil)
+//     if err != nil {
+//         return err
+//     }
+//     wr := bundler.NewWriter(sw, []bundler.WriterOption{bundler.WithOverflowWriter(sw.Overflow())})
+//     wr.Write([]byte("Hello, World!"))
+//
+// or
+//
+//     wr := diode.NewWriter(sw, 1000, 0, nil, []diode.WriterOption{diode.WithOverflowWriter(sw.Overflow())})
+//
+// Once records are spilled, newer records are spilled as well until the queue
+// is drained, to preserve their order.
+func NewWriter(w io.Writer, dir string, opts []WriterOption) (*Writer, error) {
+	sw := &Writer{
+		w:        w,
+		interval: DefaultReplayInterval,
+		onError: func(err error) {
+			log.Printf("Spill failed due to: %v", err)
+		},
+		lock: &sync.Mutex{},
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	q, err := segment.Open(dir, sw.applyOpts(opts)...)
+	if err != nil {
+		return nil, err
+	}
+	sw.q = q
+
+	go sw.replayLoop()
+
+	return sw, nil
+}
+
+func (sw *Writer) applyOpts(opts []WriterOption) []segment.Option {
+	sOpts := make([]segment.Option, 0)
+
+	for _, o := range opts {
+		sOpt := o(sw)
+		if sOpt != nil {
+			sOpts = append(sOpts, sOpt)
+		}
+	}
+
+	return sOpts
+}
+
+func (sw *Writer) Write(p []byte) (int, error) {
+	sw.lock.Lock()
+	defer sw.lock.Unlock()
+
+	if sw.q.Empty() {
+		if _, err := sw.w.Write(p); err == nil {
+			return len(p), nil
+		}
+	}
+
+	if err := spill(sw.q, p); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// spill appends p to the queue and syncs it, so that a spilled record
+// survives a crash.
+func spill(q *segment.Queue, p []byte) error {
+	if err := q.Append(p); err != nil {
+		return err
+	}
+
+	return q.Sync()
+}
+
+// Overflow returns a writer that appends every record straight to the
+// disk-backed queue. It can be handed to the writers able to report the
+// records they had to drop, see bundler.WithOverflowWriter and
+// diode.WithOverflowWriter. The stream writer blocks instead of dropping
+// records, it needs none.
+func (sw *Writer) Overflow() io.Writer {
+	return overflowWriter{sw.q}
+}
+
+// Pending returns the number of bytes waiting on disk to be replayed.
+func (sw *Writer) Pending() int64 {
+	return sw.q.Size()
+}
+
+// Close stops the replay, releases the segment files and call Close on the
+// wrapped writer if io.Closer is implemented. Records not replayed yet are
+// kept on disk for the next process.
+func (sw *Writer) Close() error {
+	close(sw.stop)
+	<-sw.done
+
+	sw.lock.Lock()
+	defer sw.lock.Unlock()
+
+	if err := sw.q.Close(); err != nil {
+		sw.onError(err)
+	}
+
+	if w, ok := sw.w.(io.Closer); ok {
+		return w.Close()
+	}
+
+	return nil
+}
+
+func (sw *Writer) replayLoop() {
+	defer close(sw.done)
+
+	t := time.NewTicker(sw.interval)
+	defer t.Stop()
+
+	sw.replay()
+
+	for {
+		select {
+		case <-sw.stop:
+			return
+		case <-t.C:
+			sw.replay()
+		}
+	}
+}
+
+// replay writes the spilled records in order until the queue is empty or
+// the underlying writer fails again.
+func (sw *Writer) replay() {
+	sw.lock.Lock()
+	defer sw.lock.Unlock()
+
+	for {
+		select {
+		case <-sw.stop:
+			return
+		default:
+		}
+
+		p, err := sw.q.Peek()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			sw.onError(err)
+			return
+		}
+
+		if _, err := sw.w.Write(p); err != nil {
+			return
+		}
+
+		if err := sw.q.Commit(); err != nil {
+			sw.onError(err)
+			return
+		}
+	}
+}
+
+type overflowWriter struct {
+	q *segment.Queue
+}
+
+func (o overflowWriter) Write(p []byte) (int, error) {
+	if err := spill(o.q, p); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
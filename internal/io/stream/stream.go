@@ -1,6 +1,7 @@
 package stream
 
 import (
+	"bytes"
 	"io"
 	"log"
 
@@ -22,24 +23,59 @@ var (
 	errClosed = errors.New("writer already closed")
 )
 
+const (
+	DefaultMaxLineSize = 1 << 20 // 1MiB
+)
+
+// WriterOption can be used to setup the writer.
+type WriterOption func(*Writer)
+
+// WithLineSplitting makes the writer split its input into newline delimited
+// records instead of treating each Write as one record. Partial lines are
+// buffered until their newline arrives or the writer is closed, so the writer
+// can be fed by any io.Writer producer such as io.Copy or exec.Cmd.Stdout.
+func WithLineSplitting() WriterOption {
+	return WriterOption(func(w *Writer) {
+		w.split = true
+	})
+}
+
+// WithMaxLineSize sets the size (in bytes) at which a partial line is emitted
+// as a record without waiting for its newline, when splitting lines.
+// The default is DefaultMaxLineSize.
+func WithMaxLineSize(n int) WriterOption {
+	return WriterOption(func(w *Writer) {
+		w.maxLineSize = n
+	})
+}
+
 type Writer struct {
 	w   io.Writer
 	in  chan interface{}
 	out chan interface{}
 
+	split       bool
+	maxLineSize int
+	partial     []byte
+
 	done   chan struct{}
 	closed *atomic.Bool
 	lock   *sync.Mutex
 }
 
-func NewWriter(w io.Writer, flows []streams.Flow) *Writer {
+func NewWriter(w io.Writer, flows []streams.Flow, opts []WriterOption) *Writer {
 	wr := &Writer{
-		w:      w,
-		in:     make(chan interface{}),
-		out:    make(chan interface{}),
-		done:   make(chan struct{}),
-		closed: &atomic.Bool{},
-		lock:   &sync.Mutex{},
+		w:           w,
+		in:          make(chan interface{}),
+		out:         make(chan interface{}),
+		maxLineSize: DefaultMaxLineSize,
+		done:        make(chan struct{}),
+		closed:      &atomic.Bool{},
+		lock:        &sync.Mutex{},
+	}
+
+	for _, o := range opts {
+		o(wr)
 	}
 
 	go wr.write()
@@ -56,6 +92,12 @@ func (w *Writer) Write(p []byte) (int, error) {
 		return 0, errClosed
 	}
 
+	if w.split {
+		w.splitLines(p)
+
+		return len(p), nil
+	}
+
 	// p might be pooled so we avoid to hold a reference to it, and instead copy it.
 	p = append(bufPool.Get().([]byte), p...)
 	w.in <- p
@@ -63,6 +105,62 @@ func (w *Writer) Write(p []byte) (int, error) {
 	return len(p), nil
 }
 
+// splitLines sends the complete lines of the buffered input followed by p
+// and buffers the rest.
+func (w *Writer) splitLines(p []byte) {
+	// the buffered input holds no newline, only p has to be searched
+	from := len(w.partial)
+	w.partial = append(w.partial, p...)
+
+	off := 0
+	for {
+		i := bytes.IndexByte(w.partial[from:], '\n')
+		if i < 0 {
+			break
+		}
+		end := from + i + 1
+
+		w.in <- append(bufPool.Get().([]byte), w.partial[off:end]...)
+		off, from = end, end
+	}
+
+	// reclaim the consumed part of the buffer, the rest comes from p
+	if off > 0 {
+		n := copy(w.partial, w.partial[off:])
+		w.partial = w.partial[:n]
+	}
+
+	if len(w.partial) >= w.maxLineSize {
+		w.flushPartial()
+	}
+}
+
+func (w *Writer) flushPartial() {
+	if len(w.partial) == 0 {
+		return
+	}
+
+	w.in <- append(bufPool.Get().([]byte), w.partial...)
+	w.partial = nil
+}
+
+// WriteRecord writes p along with its metadata md, which saves the flows
+// built by stream.NewBasicFlow from extracting it again.
+func (w *Writer) WriteRecord(md stream.Metadata, p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.closed.Get() {
+		return 0, errClosed
+	}
+
+	// p might be pooled so we avoid to hold a reference to it, and instead copy it.
+	p = append(bufPool.Get().([]byte), p...)
+	w.in <- &stream.Record{Metadata: md, Payload: p}
+
+	return len(p), nil
+}
+
 func (w *Writer) Close() error {
 	w.lock.Lock()
 	defer w.lock.Unlock()
@@ -70,6 +168,9 @@ func (w *Writer) Close() error {
 	// mark as closed
 	w.closed.Set(true)
 
+	// send the last partial line
+	w.flushPartial()
+
 	// close the input channel
 	close(w.in)
 
@@ -96,7 +197,16 @@ func (w *Writer) init(flows []streams.Flow) {
 
 func (w *Writer) write() {
 	for e := range w.out {
-		p := e.([]byte)
+		var p []byte
+		switch x := e.(type) {
+		case []byte:
+			p = x
+		case *stream.Record:
+			p = x.Payload
+		default:
+			continue
+		}
+
 		_, err := w.w.Write(p)
 		if err != nil {
 			log.Printf("err occurred: %v\n", err)
@@ -0,0 +1,503 @@
+package segment
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	DefaultSegmentSize = 16 * 1e6   // 16MiB
+	DefaultMaxSize     = 1024 * 1e6 // 1GiB
+
+	headerSize     = 8
+	segmentExt     = ".seg"
+	checkpointFile = "checkpoint"
+	checkpointSize = 16
+)
+
+//nolint:gochecknoglobals  // necessary to maintain errors
+var (
+	ErrFull   = errors.New("segment queue is full")
+	ErrClosed = errors.New("segment queue already closed")
+)
+
+// Option can be used to setup the queue.
+type Option func(*Queue)
+
+// WithSegmentSize sets the size (in bytes) after which a new segment file is started.
+// The default is DefaultSegmentSize.
+func WithSegmentSize(n int64) Option {
+	return Option(func(q *Queue) {
+		q.segmentSize = n
+	})
+}
+
+// WithMaxSize sets the maximum number of pending bytes kept on disk before
+// Append returns ErrFull. The default is DefaultMaxSize.
+func WithMaxSize(n int64) Option {
+	return Option(func(q *Queue) {
+		q.maxSize = n
+	})
+}
+
+type position struct {
+	id  uint64
+	off int64
+}
+
+// Queue is a persistent FIFO queue of records stored in segment files inside a directory.
+//
+// Each record is stored as
+//
+//    | length (4 bytes) | crc32 (4 bytes) | payload (length bytes) |
+//
+// Records are read with Peek and removed with Commit, which persists the read
+// position in a checkpoint file so that a reopened queue resumes from the first
+// record that was not committed. Segments that are fully committed are deleted.
+// The checkpoint and the full segments are synced to stable storage, the
+// records of the current segment are only once Sync or Close is called.
+// Records failing the checksum, e.g. partially written before a crash, are skipped
+// together with the rest of their segment.
+type Queue struct {
+	dir         string
+	segmentSize int64
+	maxSize     int64
+
+	lock     *sync.Mutex
+	segments []uint64
+	head     position
+	next     int64
+	r        *os.File
+	w        *os.File
+	wsize    int64
+	size     int64
+	closed   bool
+}
+
+// Open opens the queue stored in dir, creating the directory if needed.
+// Appends always go to a new segment so that a record truncated by a crash
+// never hides the records written after it.
+func Open(dir string, opts ...Option) (*Queue, error) {
+	q := &Queue{
+		dir:         dir,
+		segmentSize: DefaultSegmentSize,
+		maxSize:     DefaultMaxSize,
+		lock:        &sync.Mutex{},
+	}
+
+	for _, o := range opts {
+		o(q)
+	}
+
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+
+	if err := q.rotate(); err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// Append adds p at the end of the queue.
+func (q *Queue) Append(p []byte) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+
+	n := int64(headerSize + len(p))
+	if q.maxSize > 0 && q.size+n > q.maxSize {
+		return ErrFull
+	}
+
+	if q.wsize >= q.segmentSize {
+		if err := q.rotate(); err != nil {
+			return err
+		}
+	}
+
+	buf := make([]byte, n)
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(p)))
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(p))
+	copy(buf[headerSize:], p)
+
+	if _, err := q.w.Write(buf); err != nil {
+		return err
+	}
+
+	q.wsize += n
+	q.size += n
+
+	return nil
+}
+
+// Peek returns the first record of the queue without removing it.
+// io.EOF is returned when the queue is empty.
+func (q *Queue) Peek() ([]byte, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.closed {
+		return nil, ErrClosed
+	}
+
+	return q.peek()
+}
+
+func (q *Queue) peek() ([]byte, error) {
+	for {
+		p, err := q.read()
+		if err == nil {
+			return p, nil
+		}
+
+		if q.head.id == q.tail() {
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+
+			// nothing can follow a broken record in the segment being written
+			q.drop(q.wsize - q.head.off)
+			q.head.off = q.wsize
+
+			return nil, io.EOF
+		}
+
+		// the segment is consumed or broken, continue with the next one
+		if err := q.advance(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Commit removes the record returned by the last Peek.
+func (q *Queue) Commit() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+
+	if q.next <= q.head.off {
+		return nil
+	}
+
+	q.size -= q.next - q.head.off
+	q.head.off = q.next
+
+	return q.checkpoint()
+}
+
+// Discard removes the first n records of the queue, or all of them if there
+// are fewer, and persists the read position once.
+func (q *Queue) Discard(n int) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+
+	for i := 0; i < n; i++ {
+		_, err := q.peek()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		q.size -= q.next - q.head.off
+		q.head.off = q.next
+	}
+
+	return q.checkpoint()
+}
+
+// Empty reports whether there are no records left to read.
+func (q *Queue) Empty() bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.size <= 0
+}
+
+// Size returns the number of bytes pending on disk.
+func (q *Queue) Size() int64 {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.size
+}
+
+// Sync commits the current segment to stable storage.
+func (q *Queue) Sync() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+
+	return q.w.Sync()
+}
+
+// Close syncs and closes the segment files. Pending records stay on disk.
+func (q *Queue) Close() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+
+	if q.r != nil {
+		_ = q.r.Close()
+	}
+
+	if err := q.w.Sync(); err != nil {
+		_ = q.w.Close()
+		return err
+	}
+
+	return q.w.Close()
+}
+
+func (q *Queue) load() error {
+	files, err := ioutil.ReadDir(q.dir)
+	if err != nil {
+		return err
+	}
+
+	sizes := make(map[uint64]int64)
+
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), segmentExt) {
+			continue
+		}
+
+		id, err := strconv.ParseUint(strings.TrimSuffix(f.Name(), segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		q.segments = append(q.segments, id)
+		sizes[id] = f.Size()
+	}
+
+	sort.Slice(q.segments, func(i, j int) bool { return q.segments[i] < q.segments[j] })
+
+	if len(q.segments) == 0 {
+		return nil
+	}
+
+	q.head = position{id: q.segments[0]}
+	if cp, ok := q.readCheckpoint(); ok {
+		if _, exists := sizes[cp.id]; exists {
+			q.head = cp
+		}
+	}
+
+	// remove the segments fully committed before the checkpoint
+	for len(q.segments) > 0 && q.segments[0] < q.head.id {
+		if err := os.Remove(q.path(q.segments[0])); err != nil {
+			return err
+		}
+		q.segments = q.segments[1:]
+	}
+
+	for _, id := range q.segments {
+		q.size += sizes[id]
+	}
+	q.size -= q.head.off
+	q.next = q.head.off
+
+	return nil
+}
+
+func (q *Queue) rotate() error {
+	id := uint64(1)
+	if len(q.segments) > 0 {
+		id = q.tail() + 1
+	}
+
+	f, err := os.OpenFile(q.path(id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+
+	if err := syncDir(q.dir); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if q.w != nil {
+		// the full segment is committed before the next one is written
+		if err := q.w.Sync(); err != nil {
+			_ = f.Close()
+			return err
+		}
+		if err := q.w.Close(); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+
+	if len(q.segments) == 0 {
+		q.head = position{id: id}
+		q.next = 0
+	}
+
+	q.segments = append(q.segments, id)
+	q.w = f
+	q.wsize = 0
+
+	return nil
+}
+
+func (q *Queue) read() ([]byte, error) {
+	if q.r == nil {
+		f, err := os.Open(q.path(q.head.id))
+		if err != nil {
+			return nil, err
+		}
+		q.r = f
+	}
+
+	var header [headerSize]byte
+	if _, err := q.r.ReadAt(header[:], q.head.off); err != nil {
+		return nil, err
+	}
+
+	n := binary.LittleEndian.Uint32(header[0:4])
+	sum := binary.LittleEndian.Uint32(header[4:8])
+
+	p := make([]byte, n)
+	if _, err := q.r.ReadAt(p, q.head.off+headerSize); err != nil {
+		return nil, fmt.Errorf("truncated record: %w", err)
+	}
+
+	if crc32.ChecksumIEEE(p) != sum {
+		return nil, errors.New("checksum mismatch")
+	}
+
+	q.next = q.head.off + headerSize + int64(n)
+
+	return p, nil
+}
+
+func (q *Queue) advance() error {
+	if q.r != nil {
+		_ = q.r.Close()
+		q.r = nil
+	}
+
+	fi, err := os.Stat(q.path(q.head.id))
+	if err == nil {
+		q.drop(fi.Size() - q.head.off)
+	}
+
+	if err := os.Remove(q.path(q.head.id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	q.segments = q.segments[1:]
+	q.head = position{id: q.segments[0]}
+	q.next = 0
+
+	return q.checkpoint()
+}
+
+func (q *Queue) drop(n int64) {
+	if n > 0 {
+		q.size -= n
+	}
+}
+
+func (q *Queue) tail() uint64 {
+	return q.segments[len(q.segments)-1]
+}
+
+func (q *Queue) path(id uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", id, segmentExt))
+}
+
+// checkpoint persists the read position. It is written to a temporary file
+// renamed over the previous checkpoint, so that a crash leaves either of them.
+func (q *Queue) checkpoint() error {
+	var buf [checkpointSize]byte
+	binary.LittleEndian.PutUint64(buf[0:8], q.head.id)
+	binary.LittleEndian.PutUint64(buf[8:16], uint64(q.head.off))
+
+	tmp := filepath.Join(q.dir, checkpointFile+".tmp")
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(buf[:]); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, filepath.Join(q.dir, checkpointFile)); err != nil {
+		return err
+	}
+
+	return syncDir(q.dir)
+}
+
+// syncDir commits the entries of dir, i.e. the files created, renamed or
+// removed, to stable storage.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	if err := d.Sync(); err != nil {
+		_ = d.Close()
+		return err
+	}
+
+	return d.Close()
+}
+
+func (q *Queue) readCheckpoint() (position, bool) {
+	buf, err := ioutil.ReadFile(filepath.Join(q.dir, checkpointFile))
+	if err != nil || len(buf) != checkpointSize {
+		return position{}, false
+	}
+
+	return position{
+		id:  binary.LittleEndian.Uint64(buf[0:8]),
+		off: int64(binary.LittleEndian.Uint64(buf[8:16])),
+	}, true
+}
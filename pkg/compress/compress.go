@@ -0,0 +1,145 @@
+package compress
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	headerSize = 5
+)
+
+// Codec is a compression algorithm.
+type Codec byte
+
+const (
+	None Codec = iota
+	Gzip
+	Zstd
+	Snappy
+)
+
+//nolint:gochecknoglobals  // necessary to share the zstd encoder and decoder, costly to create, and errors
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+
+	ErrUnknownCodec = errors.New("unknown compression codec")
+)
+
+func (c Codec) String() string {
+	switch c {
+	case None:
+		return "none"
+	case Gzip:
+		return "gzip"
+	case Zstd:
+		return "zstd"
+	case Snappy:
+		return "snappy"
+	default:
+		return fmt.Sprintf("codec(%d)", byte(c))
+	}
+}
+
+// Compress returns p compressed with c.
+func Compress(c Codec, p []byte) ([]byte, error) {
+	switch c {
+	case None:
+		return p, nil
+	case Gzip:
+		buf := &bytes.Buffer{}
+		zw := gzip.NewWriter(buf)
+		if _, err := zw.Write(p); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+
+		return buf.Bytes(), nil
+	case Zstd:
+		return zstdEncoder.EncodeAll(p, nil), nil
+	case Snappy:
+		return snappy.Encode(nil, p), nil
+	default:
+		return nil, ErrUnknownCodec
+	}
+}
+
+// Decompress returns p decompressed with c.
+func Decompress(c Codec, p []byte) ([]byte, error) {
+	switch c {
+	case None:
+		return p, nil
+	case Gzip:
+		zr, err := gzip.NewReader(bytes.NewReader(p))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+
+		return ioutil.ReadAll(zr)
+	case Zstd:
+		return zstdDecoder.DecodeAll(p, nil)
+	case Snappy:
+		return snappy.Decode(nil, p)
+	default:
+		return nil, ErrUnknownCodec
+	}
+}
+
+// WriteFrame compresses p with c and writes it to w as a single frame
+//
+//    | length (4 bytes) | codec (1 byte) | compressed data (length bytes) |
+//
+// with a single call to Write. Each frame can be decompressed on its own.
+func WriteFrame(w io.Writer, c Codec, p []byte) error {
+	data, err := Compress(c, p)
+	if err != nil {
+		return err
+	}
+
+	frame := make([]byte, headerSize+len(data))
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(data)))
+	frame[4] = byte(c)
+	copy(frame[headerSize:], data)
+
+	_, err = w.Write(frame)
+
+	return err
+}
+
+// Reader reads the frames written by WriteFrame.
+type Reader struct {
+	r io.Reader
+}
+
+// NewReader returns a Reader reading frames from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r}
+}
+
+// Next returns the decompressed content of the next frame.
+// io.EOF is returned once r is exhausted.
+func (r *Reader) Next() ([]byte, error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r.r, header[:]); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, binary.BigEndian.Uint32(header[0:4]))
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return nil, fmt.Errorf("truncated frame: %w", err)
+	}
+
+	return Decompress(Codec(header[4]), data)
+}
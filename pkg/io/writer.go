@@ -19,6 +19,12 @@ type WriteCloserSync interface {
 	WriteSyncer
 }
 
+// A Backpressurer is a non-blocking writer able to report how full its internal
+// buffer is, from 0 (empty) to 1 (full, writes are being dropped).
+type Backpressurer interface {
+	Backpressure() float64
+}
+
 func AddCloserSync(w io.Writer) WriteCloserSync {
 	switch w := w.(type) {
 	case io.WriteCloser:
@@ -0,0 +1,93 @@
+package logrusx
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/BinaryHexer/nbw/pkg/stream"
+)
+
+const (
+	LevelKey   = "level"
+	MessageKey = "msg"
+)
+
+// Hook is a logrus.Hook writing the entries to a nbw writer.
+//
+// The level, message and data fields of each entry are also handed as
+// stream.Metadata to writers implementing stream.RecordWriter, such as the
+// stream writer, so that the flows built by stream.NewBasicFlow don't need
+// to parse the formatted entry again.
+type Hook struct {
+	w         io.Writer
+	formatter logrus.Formatter
+	levels    []logrus.Level
+}
+
+// NewHook creates a Hook writing the entries of the given levels to w,
+// typically one of the nbw writers, using formatter. If no level is given,
+// all the levels are hooked. If formatter is nil, the formatter of the logger
+// is used.
+//
+//     wr := nbw.NewBundlerWriter(conn)
+//     hook := logrusx.NewHook(wr, &logrus.JSONFormatter{})
+//     logrus.AddHook(hook)
+//     logrusx.CloseOnExit(logrus.StandardLogger(), hook)
+func NewHook(w io.Writer, formatter logrus.Formatter, levels ...logrus.Level) *Hook {
+	if len(levels) == 0 {
+		levels = logrus.AllLevels
+	}
+
+	return &Hook{
+		w:         w,
+		formatter: formatter,
+		levels:    levels,
+	}
+}
+
+func (h *Hook) Levels() []logrus.Level {
+	return h.levels
+}
+
+func (h *Hook) Fire(e *logrus.Entry) error {
+	formatter := h.formatter
+	if formatter == nil {
+		formatter = e.Logger.Formatter
+	}
+
+	p, err := formatter.Format(e)
+	if err != nil {
+		return err
+	}
+
+	if rw, ok := h.w.(stream.RecordWriter); ok {
+		_, err = rw.WriteRecord(metadata(e), p)
+	} else {
+		_, err = h.w.Write(p)
+	}
+
+	return err
+}
+
+// Close call Close on the wrapped writer if io.Closer is implemented,
+// which writes the entries still buffered.
+func (h *Hook) Close() error {
+	if w, ok := h.w.(io.Closer); ok {
+		return w.Close()
+	}
+
+	return nil
+}
+
+func metadata(e *logrus.Entry) stream.Metadata {
+	md := make(stream.Metadata, len(e.Data)+2)
+	for k, v := range e.Data {
+		md[k] = fmt.Sprint(v)
+	}
+	md[LevelKey] = e.Level.String()
+	md[MessageKey] = e.Message
+
+	return md
+}
@@ -0,0 +1,67 @@
+package logrusx
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/BinaryHexer/nbw"
+)
+
+const records = 1000
+
+func writers() []func(w io.Writer) io.WriteCloser {
+	return []func(w io.Writer) io.WriteCloser{
+		func(w io.Writer) io.WriteCloser { return nbw.NewBundlerWriter(w) },
+		func(w io.Writer) io.WriteCloser { return nbw.NewDiodeWriter(w, 10*records, 0, nil) },
+		func(w io.Writer) io.WriteCloser { return nbw.NewStreamWriter(w) },
+	}
+}
+
+func TestHook(t *testing.T) {
+	for idx, wr := range writers() {
+		t.Run(fmt.Sprintf("%d", idx), func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			hook := NewHook(wr(buf), &logrus.JSONFormatter{})
+
+			l := logrus.New()
+			l.SetOutput(ioutil.Discard)
+			l.AddHook(hook)
+
+			for i := 0; i < records; i++ {
+				l.WithField("iter", i).Info("hello world")
+			}
+
+			err := hook.Close()
+			assert.NoError(t, err)
+			assert.Equal(t, records, strings.Count(buf.String(), "\n"))
+		})
+	}
+}
+
+func TestSetOutput(t *testing.T) {
+	for idx, wr := range writers() {
+		t.Run(fmt.Sprintf("%d", idx), func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			exited := false
+
+			l := logrus.New()
+			l.ExitFunc = func(int) { exited = true }
+			SetOutput(l, wr(buf))
+
+			for i := 0; i < records-1; i++ {
+				l.WithField("iter", i).Info("hello world")
+			}
+			l.Fatal("exiting")
+
+			assert.True(t, exited)
+			assert.Equal(t, records, strings.Count(buf.String(), "\n"))
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package logrusx
+
+import (
+	"io"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SetOutput sets w, typically one of the nbw writers, as the output of l and
+// closes it before l exits the program, so that Fatal entries and the ones
+// logged before them are not lost.
+func SetOutput(l *logrus.Logger, w io.Writer) {
+	l.SetOutput(w)
+
+	if c, ok := w.(io.Closer); ok {
+		CloseOnExit(l, c)
+	}
+}
+
+// CloseOnExit closes c before l exits the program, e.g. after a Fatal entry.
+func CloseOnExit(l *logrus.Logger, c io.Closer) {
+	exit := l.ExitFunc
+	if exit == nil {
+		exit = logrus.StandardLogger().ExitFunc
+	}
+
+	l.ExitFunc = func(code int) {
+		_ = c.Close()
+		exit(code)
+	}
+}
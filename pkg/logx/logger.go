@@ -0,0 +1,41 @@
+package logx
+
+import (
+	"io"
+	"log"
+)
+
+// SetOutput sets w, typically one of the nbw writers, as the output of the
+// standard logger. The returned function restores the previous output and
+// closes w, if io.Closer is implemented, which writes the lines still buffered.
+//
+//     restore := logx.SetOutput(nbw.NewBundlerWriter(os.Stderr))
+//     defer restore()
+func SetOutput(w io.Writer) func() error {
+	prev := log.Writer()
+	log.SetOutput(w)
+
+	return func() error {
+		log.SetOutput(prev)
+		return closeWriter(w)
+	}
+}
+
+// SetLoggerOutput is like SetOutput for the logger l.
+func SetLoggerOutput(l *log.Logger, w io.Writer) func() error {
+	prev := l.Writer()
+	l.SetOutput(w)
+
+	return func() error {
+		l.SetOutput(prev)
+		return closeWriter(w)
+	}
+}
+
+func closeWriter(w io.Writer) error {
+	if c, ok := w.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package logx
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/BinaryHexer/nbw"
+)
+
+const records = 1000
+
+func TestSetOutput(t *testing.T) {
+	tests := []struct {
+		w func(w io.Writer) io.WriteCloser
+	}{
+		{w: func(w io.Writer) io.WriteCloser { return nbw.NewBundlerWriter(w) }},
+		{w: func(w io.Writer) io.WriteCloser { return nbw.NewDiodeWriter(w, 10*records, 0, nil) }},
+		{w: func(w io.Writer) io.WriteCloser { return nbw.NewStreamWriter(w) }},
+	}
+
+	for _, tt := range tests {
+		buf := &bytes.Buffer{}
+		prev := log.Writer()
+		restore := SetOutput(tt.w(buf))
+
+		for i := 0; i < records; i++ {
+			log.Printf("hello world %d", i)
+		}
+
+		err := restore()
+		assert.NoError(t, err)
+		assert.Equal(t, prev, log.Writer())
+		assert.Equal(t, records, strings.Count(buf.String(), "\n"))
+	}
+}
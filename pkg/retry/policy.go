@@ -0,0 +1,115 @@
+package retry
+
+import (
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"time"
+)
+
+const (
+	DefaultMaxAttempts    = 3
+	DefaultInitialBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff     = 5 * time.Second
+	DefaultMultiplier     = 2
+	DefaultJitter         = 0.2
+)
+
+// Classifier reports whether a failed write should be attempted again.
+type Classifier func(err error) bool
+
+// Policy describes how many times a failed write is attempted and how long
+// to wait between the attempts.
+//
+// The wait before the nth retry is InitialBackoff * Multiplier^(n-1), capped at
+// MaxBackoff and randomized by +/- Jitter (a fraction between 0 and 1).
+type Policy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	Jitter         float64
+	Retryable      Classifier
+}
+
+// DefaultPolicy returns a Policy using the package defaults and IsRetryable
+// as classifier.
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxAttempts:    DefaultMaxAttempts,
+		InitialBackoff: DefaultInitialBackoff,
+		MaxBackoff:     DefaultMaxBackoff,
+		Multiplier:     DefaultMultiplier,
+		Jitter:         DefaultJitter,
+		Retryable:      IsRetryable,
+	}
+}
+
+// Do calls fn until it succeeds, returns a non retryable error or the
+// maximum number of attempts is reached. The last error is returned.
+func (p Policy) Do(fn func() error) error {
+	var err error
+
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= p.MaxAttempts || !p.retryable(err) {
+			return err
+		}
+
+		time.Sleep(p.Backoff(attempt))
+	}
+}
+
+// Backoff returns the time to wait after the given (1-based) failed attempt.
+func (p Policy) Backoff(attempt int) time.Duration {
+	if attempt < 1 || p.InitialBackoff <= 0 {
+		return 0
+	}
+
+	m := p.Multiplier
+	if m < 1 {
+		m = 1
+	}
+
+	d := float64(p.InitialBackoff) * math.Pow(m, float64(attempt-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+
+	if p.Jitter > 0 {
+		//nolint:gosec  // jitter does not need a cryptographically secure source
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+
+	return time.Duration(d)
+}
+
+func (p Policy) retryable(err error) bool {
+	if p.Retryable == nil {
+		return IsRetryable(err)
+	}
+
+	return p.Retryable(err)
+}
+
+// IsRetryable is the default Classifier. Errors reporting themselves as
+// temporary are retried according to their Temporary method, writes to
+// closed files or pipes are never retried and everything else is.
+func IsRetryable(err error) bool {
+	var t interface{ Temporary() bool }
+	if errors.As(err, &t) {
+		return t.Temporary()
+	}
+
+	if errors.Is(err, os.ErrClosed) || errors.Is(err, io.ErrClosedPipe) {
+		return false
+	}
+
+	return true
+}
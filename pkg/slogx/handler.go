@@ -0,0 +1,155 @@
+//go:build go1.21
+// +build go1.21
+
+package slogx
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/BinaryHexer/nbw/pkg/stream"
+)
+
+const (
+	LevelKey   = "level"
+	MessageKey = "msg"
+)
+
+type buffer struct {
+	lock *sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *buffer) Write(p []byte) (int, error) {
+	return b.buf.Write(p)
+}
+
+// Handler is a slog.Handler encoding the records as JSON and writing them to
+// a nbw writer.
+//
+// The attributes of each record are also collected as stream.Metadata and
+// handed to writers implementing stream.RecordWriter, such as the stream
+// writer, so that the flows built by stream.NewBasicFlow don't need to parse
+// the JSON again. Attributes in groups are keyed by their dotted path, e.g.
+// "request.path", the level is lower-cased under LevelKey and the message is
+// stored under MessageKey.
+type Handler struct {
+	w     io.Writer
+	json  slog.Handler
+	buf   *buffer
+	md    stream.Metadata
+	group string
+}
+
+// NewHandler creates a Handler writing to w, typically one of the nbw writers.
+// If opts is nil, the default options are used.
+//
+//     wr := nbw.NewStreamWriter(os.Stdout, stream.NewBasicFlow(...))
+//     logger := slog.New(slogx.NewHandler(wr, nil))
+//     logger.Info("hello world", "uuid", "ID001")
+func NewHandler(w io.Writer, opts *slog.HandlerOptions) *Handler {
+	buf := &buffer{lock: &sync.Mutex{}}
+
+	return &Handler{
+		w:    w,
+		json: slog.NewJSONHandler(buf, opts),
+		buf:  buf,
+		md:   stream.Metadata{},
+	}
+}
+
+func (h *Handler) Enabled(ctx context.Context, lvl slog.Level) bool {
+	return h.json.Enabled(ctx, lvl)
+}
+
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	md := make(stream.Metadata, len(h.md)+r.NumAttrs()+2)
+	for k, v := range h.md {
+		md[k] = v
+	}
+	md[LevelKey] = strings.ToLower(r.Level.String())
+	md[MessageKey] = r.Message
+	r.Attrs(func(a slog.Attr) bool {
+		addAttr(md, h.group, a)
+		return true
+	})
+
+	h.buf.lock.Lock()
+	err := h.json.Handle(ctx, r)
+	p := append([]byte(nil), h.buf.buf.Bytes()...)
+	h.buf.buf.Reset()
+	h.buf.lock.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	if rw, ok := h.w.(stream.RecordWriter); ok {
+		_, err = rw.WriteRecord(md, p)
+	} else {
+		_, err = h.w.Write(p)
+	}
+
+	return err
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := h.clone()
+	clone.json = h.json.WithAttrs(attrs)
+	for _, a := range attrs {
+		addAttr(clone.md, h.group, a)
+	}
+
+	return clone
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	clone := h.clone()
+	clone.json = h.json.WithGroup(name)
+	clone.group = h.group + name + "."
+
+	return clone
+}
+
+func (h *Handler) clone() *Handler {
+	md := make(stream.Metadata, len(h.md))
+	for k, v := range h.md {
+		md[k] = v
+	}
+
+	return &Handler{
+		w:     h.w,
+		json:  h.json,
+		buf:   h.buf,
+		md:    md,
+		group: h.group,
+	}
+}
+
+func addAttr(md stream.Metadata, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix = prefix + a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			addAttr(md, prefix, ga)
+		}
+
+		return
+	}
+
+	md[prefix+a.Key] = a.Value.String()
+}
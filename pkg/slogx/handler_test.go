@@ -0,0 +1,64 @@
+//go:build go1.21
+// +build go1.21
+
+package slogx
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/BinaryHexer/nbw"
+	"github.com/BinaryHexer/nbw/pkg/stream"
+)
+
+func TestHandler(t *testing.T) {
+	buf := &bytes.Buffer{}
+	var mds []stream.Metadata
+	var lock sync.Mutex
+
+	w := nbw.NewStreamWriter(buf, stream.NewBasicFlow(
+		func(i []byte) (stream.Metadata, []byte) {
+			t.Error("records should not be parsed again")
+			return stream.Metadata{}, i
+		},
+		func(md stream.Metadata) bool {
+			lock.Lock()
+			mds = append(mds, md)
+			lock.Unlock()
+			return md[LevelKey] != "debug"
+		},
+		func(md stream.Metadata) string {
+			return md["uuid"]
+		},
+		func(mds []stream.Metadata) bool {
+			return true
+		},
+	))
+
+	logger := slog.New(NewHandler(w, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})).With("uuid", "ID001")
+
+	logger.Debug("dropped")
+	logger.WithGroup("request").Info("request", "path", "/api/path", "size", 1100)
+
+	err := w.Close()
+	assert.NoError(t, err)
+
+	assert.Equal(t, `{"level":"INFO","msg":"request","uuid":"ID001","request":{"path":"/api/path","size":1100}}`, strings.TrimSpace(buf.String()))
+	assert.ElementsMatch(t, []stream.Metadata{
+		{"level": "debug", "msg": "dropped", "uuid": "ID001"},
+		{"level": "info", "msg": "request", "uuid": "ID001", "request.path": "/api/path", "request.size": "1100"},
+	}, mds)
+}
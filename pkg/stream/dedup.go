@@ -0,0 +1,230 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/reugn/go-streams"
+
+	bbx "github.com/BinaryHexer/nbw/pkg/bundler"
+)
+
+// RepeatFunc returns the record emitted at the end of a window for a record
+// that was repeated. md is the metadata of the first occurrence.
+type RepeatFunc func(md Metadata, repeated int, window time.Duration) *Record
+
+// DedupOption can be used to setup the deduplicator.
+type DedupOption func(*Dedup)
+
+// WithRepeatSummary sets the function building the summary records.
+// The default is a JSON warning, see DefaultRepeatSummary.
+func WithRepeatSummary(fn RepeatFunc) DedupOption {
+	return DedupOption(func(d *Dedup) {
+		d.summary = fn
+	})
+}
+
+// WithDedupBundlerOptions sets the options of the bundlers of the Aggregator
+// closing the windows, applied after the window.
+func WithDedupBundlerOptions(opts ...bbx.Option) DedupOption {
+	return DedupOption(func(d *Dedup) {
+		d.bundlerOpts = append(d.bundlerOpts, opts...)
+	})
+}
+
+// Dedup collapses repeated elements. Elements are fingerprinted on a set of
+// metadata fields, extracted using a MapFn or taken from the Record, or on
+// their payload if no field is given.
+//
+// The first occurrence of a fingerprint is passed downstream right away and
+// opens a window: its fingerprint is grouped by an Aggregator, which flushes
+// the group at the end of the window. The next occurrences are only counted,
+// so the memory used grows with the number of distinct fingerprints rather
+// than with the number of repeats. When the group is flushed, a single summary
+// record is emitted downstream if the element was repeated.
+//
+// in  -- a -- a -- b -- a ------|window
+//        |    |    |    |       |
+//    [----------- Dedup ---------]
+//        |         |            |
+// out -- a ------- b ----------repeated(a, 2)
+type Dedup struct {
+	MapF    MapFn
+	Fields  []string
+	PanicF  PanicHandler
+	in      chan interface{}
+	out     chan interface{}
+	window  time.Duration
+	summary RepeatFunc
+	aggr    *Aggregator
+	lock    *sync.Mutex
+	repeats map[string]*repeat
+
+	bundlerOpts []bbx.Option
+}
+
+type repeat struct {
+	md    Metadata
+	count int
+}
+
+// NewDedup returns a new Dedup instance.
+// mapFunc extracts the metadata of an element, it can be nil if only records
+// are written or fields is empty. window is the duration over which the
+// repeated elements are counted.
+func NewDedup(mapFunc MapFn, fields []string, window time.Duration, opts ...DedupOption) *Dedup {
+	d := &Dedup{
+		MapF:    mapFunc,
+		Fields:  fields,
+		in:      make(chan interface{}),
+		out:     make(chan interface{}),
+		window:  window,
+		summary: DefaultRepeatSummary,
+		lock:    &sync.Mutex{},
+		repeats: make(map[string]*repeat),
+	}
+
+	for _, o := range opts {
+		o(d)
+	}
+
+	// the groups are only emitted at the end of the window
+	bOpts := append([]bbx.Option{
+		bbx.WithDelayThreshold(window),
+		bbx.WithBundleCountThreshold(math.MaxInt32),
+		bbx.WithBundleByteThreshold(math.MaxInt32),
+	}, d.bundlerOpts...)
+	d.aggr = NewAggregator(func(i interface{}) string {
+		return i.(string)
+	}, bOpts...)
+
+	go d.receive()
+	go d.summarize()
+
+	return d
+}
+
+// DefaultRepeatSummary returns a JSON record such as
+//
+//    {"level":"warn","msg":"repeated 4211 times in 10s","fields":{"msg":"connection refused"}}
+//
+// whose metadata is the one of the first occurrence, with the level and msg
+// fields replaced.
+func DefaultRepeatSummary(md Metadata, repeated int, window time.Duration) *Record {
+	msg := fmt.Sprintf("repeated %d times in %s", repeated, window)
+	fields, _ := json.Marshal(md)
+
+	smd := make(Metadata, len(md)+2)
+	for k, v := range md {
+		smd[k] = v
+	}
+	smd["level"] = "warn"
+	smd["msg"] = msg
+
+	return &Record{
+		Metadata: smd,
+		Payload:  []byte(fmt.Sprintf(`{"level":"warn","msg":%q,"fields":%s}`+"\n", msg, fields)),
+	}
+}
+
+// Via streams data through the given flow
+func (d *Dedup) Via(flow streams.Flow) streams.Flow {
+	go d.transmit(flow)
+	return flow
+}
+
+// To streams data to the given sink
+func (d *Dedup) To(sink streams.Sink) {
+	d.transmit(sink)
+}
+
+// Out returns an output channel for sending data
+func (d *Dedup) Out() <-chan interface{} {
+	return d.out
+}
+
+// In returns an input channel for receiving data
+func (d *Dedup) In() chan<- interface{} {
+	return d.in
+}
+
+func (d *Dedup) transmit(inlet streams.Inlet) {
+	for elem := range d.Out() {
+		inlet.In() <- elem
+	}
+	close(inlet.In())
+}
+
+func (d *Dedup) receive() {
+	for elem := range d.in {
+		fp, md, ok := d.fingerprint(elem)
+		if !ok {
+			continue
+		}
+
+		d.lock.Lock()
+		r, seen := d.repeats[fp]
+		if seen {
+			r.count++
+		} else {
+			d.repeats[fp] = &repeat{md: md}
+		}
+		d.lock.Unlock()
+
+		if seen {
+			continue
+		}
+
+		// only the first occurrence is grouped, it opens the window
+		d.out <- elem
+		d.aggr.In() <- fp
+	}
+
+	close(d.aggr.In())
+}
+
+// summarize emits the summaries of the windows closed by the aggregator.
+func (d *Dedup) summarize() {
+	for e := range d.aggr.Out() {
+		xs := e.([]interface{})
+		fp := xs[0].(string)
+
+		d.lock.Lock()
+		r, ok := d.repeats[fp]
+		delete(d.repeats, fp)
+		d.lock.Unlock()
+
+		if ok && r.count > 0 {
+			d.out <- d.summary(r.md, r.count, d.window)
+		}
+	}
+
+	close(d.out)
+}
+
+func (d *Dedup) fingerprint(elem interface{}) (fp string, md Metadata, ok bool) {
+	failed := false
+	defer RecoverPanic(d.PanicF, elem, &failed)
+
+	md, p, ok := extract(elem, d.MapF)
+	if !ok {
+		return "", nil, false
+	}
+
+	if len(d.Fields) == 0 {
+		return string(p), md, true
+	}
+
+	values := make([]string, len(d.Fields))
+	fields := make(Metadata, len(d.Fields))
+	for idx, f := range d.Fields {
+		values[idx] = md[f]
+		fields[f] = md[f]
+	}
+
+	return strings.Join(values, "\x00"), fields, true
+}
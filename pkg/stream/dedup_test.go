@@ -0,0 +1,66 @@
+package stream
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedup(t *testing.T) {
+	_input := []string{
+		`{"level":"error","msg":"connection refused","attempt":"1"}`,
+		`{"level":"error","msg":"connection refused","attempt":"2"}`,
+		`{"level":"info","msg":"connected"}`,
+		`{"level":"error","msg":"connection refused","attempt":"3"}`,
+		`{"level":"warn","msg":"slow query"}`,
+		`{"level":"warn","msg":"slow query"}`,
+	}
+
+	dedup := NewDedup(
+		func(i []byte) (Metadata, []byte) {
+			var obj map[string]string
+			_ = json.Unmarshal(i, &obj)
+
+			return Metadata{"level": obj["level"], "msg": obj["msg"]}, i
+		},
+		[]string{"level", "msg"},
+		time.Hour,
+	)
+
+	want := []string{
+		_input[0], _input[2], _input[4],
+		repeatString(Metadata{"level": "error", "msg": "connection refused"}, 2),
+		repeatString(Metadata{"level": "warn", "msg": "slow query"}, 1),
+	}
+
+	assert.ElementsMatch(t, want, runFlow(dedup, _input))
+}
+
+func repeatString(md Metadata, repeated int) string {
+	return string(DefaultRepeatSummary(md, repeated, time.Hour).Payload)
+}
+
+func TestDedupWindow(t *testing.T) {
+	dedup := NewDedup(nil, nil, 20*time.Millisecond)
+
+	go func() {
+		for _, msg := range []string{"a", "a", "a"} {
+			dedup.In() <- []byte(msg)
+		}
+		// let the window close before a new occurrence
+		time.Sleep(100 * time.Millisecond)
+		dedup.In() <- []byte("a")
+		close(dedup.In())
+	}()
+
+	var output []string
+	for e := range dedup.Out() {
+		p, _ := payload(e)
+		output = append(output, string(p))
+	}
+
+	summary := string(DefaultRepeatSummary(Metadata{}, 2, 20*time.Millisecond).Payload)
+	assert.Equal(t, []string{"a", summary, "a"}, output)
+}
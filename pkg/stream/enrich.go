@@ -0,0 +1,278 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/reugn/go-streams"
+)
+
+// FieldsFunc returns fields computed for every record.
+type FieldsFunc func() map[string]interface{}
+
+type field struct {
+	key   string
+	value interface{}
+	raw   []byte
+}
+
+// EnrichOption can be used to setup the enricher.
+type EnrichOption func(*Enricher)
+
+// WithField adds a static field.
+func WithField(key string, value interface{}) EnrichOption {
+	return EnrichOption(func(e *Enricher) {
+		e.fields = append(e.fields, field{key: key, value: value})
+	})
+}
+
+// WithHostname adds the host name as the "hostname" field.
+func WithHostname() EnrichOption {
+	hostname, _ := os.Hostname()
+
+	return WithField("hostname", hostname)
+}
+
+// WithPID adds the process id as the "pid" field.
+func WithPID() EnrichOption {
+	return WithField("pid", os.Getpid())
+}
+
+// WithService adds the "service" and "version" fields.
+func WithService(name, version string) EnrichOption {
+	return EnrichOption(func(e *Enricher) {
+		WithField("service", name)(e)
+		WithField("version", version)(e)
+	})
+}
+
+// WithEnvFields adds a field for every environment variable starting with
+// prefix, named after the rest of the variable in lower case. For instance,
+// with the pod labels exposed by the Kubernetes downward API as
+// POD_LABEL_APP=web, WithEnvFields("POD_LABEL_") adds "app":"web".
+func WithEnvFields(prefix string) EnrichOption {
+	return EnrichOption(func(e *Enricher) {
+		for _, kv := range os.Environ() {
+			if !strings.HasPrefix(kv, prefix) {
+				continue
+			}
+			kv = strings.TrimPrefix(kv, prefix)
+			if i := strings.IndexByte(kv, '='); i > 0 {
+				WithField(strings.ToLower(kv[:i]), kv[i+1:])(e)
+			}
+		}
+	})
+}
+
+// WithDynamicFields adds the fields returned by fn, which is called for
+// every record. They are injected after the static fields, sorted by name.
+func WithDynamicFields(fn FieldsFunc) EnrichOption {
+	return EnrichOption(func(e *Enricher) {
+		e.dynamic = append(e.dynamic, fn)
+	})
+}
+
+// WithEnrichMetadata adds the fields to the metadata as well, so that the
+// next flows can filter or group on them. Byte slices are turned into
+// records whose metadata is extracted with mapFunc, which can be nil.
+func WithEnrichMetadata(mapFunc MapFn) EnrichOption {
+	return EnrichOption(func(e *Enricher) {
+		e.MapF = mapFunc
+		e.metadata = true
+	})
+}
+
+// Enricher injects fields into the JSON records flowing through it. Fields
+// already present in a record are left untouched and records which are not
+// JSON objects are passed as is.
+//
+// in  -- {"msg":"hi"} --
+//             |
+//    [---- Enricher ----]
+//             |
+// out -- {"msg":"hi","pid":42} --
+//
+// A panic in MapF or in a FieldsFunc is recovered, the offending element is
+// handed to PanicF and dropped.
+type Enricher struct {
+	MapF     MapFn
+	PanicF   PanicHandler
+	in       chan interface{}
+	out      chan interface{}
+	fields   []field
+	dynamic  []FieldsFunc
+	metadata bool
+}
+
+// NewEnricher returns a new Enricher instance.
+func NewEnricher(opts ...EnrichOption) *Enricher {
+	e := &Enricher{
+		in:  make(chan interface{}),
+		out: make(chan interface{}),
+	}
+
+	for _, o := range opts {
+		o(e)
+	}
+
+	// static fields are encoded once
+	for i := range e.fields {
+		e.fields[i].raw, _ = json.Marshal(e.fields[i].value)
+	}
+
+	go e.receive()
+
+	return e
+}
+
+// Via streams data through the given flow
+func (e *Enricher) Via(flow streams.Flow) streams.Flow {
+	go e.transmit(flow)
+	return flow
+}
+
+// To streams data to the given sink
+func (e *Enricher) To(sink streams.Sink) {
+	e.transmit(sink)
+}
+
+// Out returns an output channel for sending data
+func (e *Enricher) Out() <-chan interface{} {
+	return e.out
+}
+
+// In returns an input channel for receiving data
+func (e *Enricher) In() chan<- interface{} {
+	return e.in
+}
+
+func (e *Enricher) transmit(inlet streams.Inlet) {
+	for elem := range e.Out() {
+		inlet.In() <- elem
+	}
+	close(inlet.In())
+}
+
+func (e *Enricher) receive() {
+	for elem := range e.in {
+		if x, ok := e.enrich(elem); ok {
+			e.out <- x
+		}
+	}
+
+	close(e.out)
+}
+
+func (e *Enricher) enrich(elem interface{}) (x interface{}, ok bool) {
+	failed := false
+	defer RecoverPanic(e.PanicF, elem, &failed)
+
+	fields := e.collect()
+
+	switch el := elem.(type) {
+	case *Record:
+		md := el.Metadata
+		if e.metadata {
+			md = withFields(md, fields)
+		}
+
+		return &Record{Metadata: md, Payload: inject(el.Payload, fields)}, true
+	case []byte:
+		if !e.metadata {
+			return inject(el, fields), true
+		}
+
+		md, p, _ := extract(el, e.MapF)
+
+		return &Record{Metadata: withFields(md, fields), Payload: inject(p, fields)}, true
+	default:
+		return elem, true
+	}
+}
+
+func (e *Enricher) collect() []field {
+	if len(e.dynamic) == 0 {
+		return e.fields
+	}
+
+	fields := append([]field(nil), e.fields...)
+	for _, fn := range e.dynamic {
+		values := fn()
+
+		keys := make([]string, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			raw, err := json.Marshal(values[k])
+			if err != nil {
+				continue
+			}
+			fields = append(fields, field{key: k, value: values[k], raw: raw})
+		}
+	}
+
+	return fields
+}
+
+// inject returns a copy of the JSON object p with the fields it lacks
+// appended. p is returned as is if it is not a JSON object.
+func inject(p []byte, fields []field) []byte {
+	obj := bytes.TrimRight(p, " \t\r\n")
+	if len(obj) < 2 || obj[0] != '{' || obj[len(obj)-1] != '}' {
+		return p
+	}
+
+	var present map[string]json.RawMessage
+	if err := json.Unmarshal(obj, &present); err != nil {
+		return p
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, len(p)+32*len(fields)))
+	buf.Write(obj[:len(obj)-1])
+
+	empty := len(present) == 0
+	for _, f := range fields {
+		if _, ok := present[f.key]; ok || f.raw == nil {
+			continue
+		}
+
+		if !empty {
+			buf.WriteByte(',')
+		}
+		empty = false
+
+		k, _ := json.Marshal(f.key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(f.raw)
+		present[f.key] = f.raw
+	}
+
+	buf.WriteByte('}')
+	// keep the record terminator, if any
+	buf.Write(p[len(obj):])
+
+	return buf.Bytes()
+}
+
+func withFields(md Metadata, fields []field) Metadata {
+	emd := make(Metadata, len(md)+len(fields))
+	for k, v := range md {
+		emd[k] = v
+	}
+
+	for _, f := range fields {
+		if _, ok := emd[f.key]; !ok {
+			emd[f.key] = fmt.Sprint(f.value)
+		}
+	}
+
+	return emd
+}
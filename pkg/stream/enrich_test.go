@@ -0,0 +1,53 @@
+package stream
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnricher(t *testing.T) {
+	_ = os.Setenv("TEST_POD_LABEL_APP", "web")
+	defer os.Unsetenv("TEST_POD_LABEL_APP")
+
+	_input := []string{
+		`{"msg":"hello"}` + "\n",
+		`{"msg":"bye","service":"other"}`,
+		`{}`,
+		`not json`,
+	}
+
+	e := NewEnricher(
+		WithService("api", "1.2.0"),
+		WithEnvFields("TEST_POD_LABEL_"),
+		WithDynamicFields(func() map[string]interface{} {
+			return map[string]interface{}{"seq": 1, "zone": "b", "host": "a"}
+		}),
+	)
+
+	want := []string{
+		`{"msg":"hello","service":"api","version":"1.2.0","app":"web","host":"a","seq":1,"zone":"b"}` + "\n",
+		`{"msg":"bye","service":"other","version":"1.2.0","app":"web","host":"a","seq":1,"zone":"b"}`,
+		`{"service":"api","version":"1.2.0","app":"web","host":"a","seq":1,"zone":"b"}`,
+		`not json`,
+	}
+
+	assert.ElementsMatch(t, want, runFlow(e, _input))
+}
+
+func TestEnricherMetadata(t *testing.T) {
+	e := NewEnricher(
+		WithField("region", "eu-west-1"),
+		WithEnrichMetadata(nil),
+	)
+
+	go func() {
+		e.In() <- []byte(`{"msg":"hello"}`)
+		close(e.In())
+	}()
+
+	r := (<-e.Out()).(*Record)
+	assert.Equal(t, Metadata{"region": "eu-west-1"}, r.Metadata)
+	assert.Equal(t, `{"msg":"hello","region":"eu-west-1"}`, string(r.Payload))
+}
@@ -1,10 +1,10 @@
 package stream
 
 import (
-	bbx "github.com/BinaryHexer/nbw/pkg/bundler"
 	"github.com/reugn/go-streams"
 	"github.com/reugn/go-streams/flow"
-	"runtime"
+
+	bbx "github.com/BinaryHexer/nbw/pkg/bundler"
 )
 
 type Metadata map[string]string
@@ -24,50 +24,126 @@ type FilterFn func(Metadata) bool
 type GroupFn func(Metadata) string
 type GroupFilterFn func([]Metadata) bool
 
+// NewBasicFlow returns a flow extracting the metadata of each element with
+// mapFunc, dropping the elements rejected by filterFunc1, grouping the rest
+// with groupFunc and dropping the groups rejected by filterFunc2.
+// It is a shorthand for
+//
+//    NewFlow(
+//        WithExtractor(mapFunc),
+//        WithFilter(filterFunc1),
+//        WithGrouping(groupFunc),
+//        WithGroupFilter(filterFunc2),
+//        WithBundlerOptions(opts...),
+//    )
+//
+// Use NewFlow to set the panic handler, the parallelism or the ordering.
 func NewBasicFlow(mapFunc MapFn, filterFunc1 FilterFn, groupFunc GroupFn, filterFunc2 GroupFilterFn, opts ...bbx.Option) streams.Flow {
-	p := uint(runtime.NumCPU())
-
-	m1 := flow.NewMap(toMapFunc(mapFunc), p)
-	f1 := flow.NewFilter(toFilterFunc(filterFunc1), p)
-	a := NewAggregator(toGroupFunc(groupFunc), opts...)
-	m2 := flow.NewMap(func(i interface{}) interface{} {
-		xs := i.([]interface{})
-		mds := make([]Metadata, len(xs))
-		for idx, x := range xs {
-			y := x.(*msg)
-			mds[idx] = y.md
-		}
+	return NewFlow(
+		WithExtractor(mapFunc),
+		WithFilter(filterFunc1),
+		WithGrouping(groupFunc),
+		WithGroupFilter(filterFunc2),
+		WithBundlerOptions(opts...),
+	)
+}
 
-		return &xmsg{
-			mds: mds,
-			d:   xs,
-		}
-	}, p)
-	f2 := flow.NewFilter(toGroupFilterFunc(filterFunc2), p)
-	fm := flow.NewFlatMap(func(i interface{}) []interface{} {
-		y := i.(*xmsg)
-		xs := y.d.([]interface{})
-		is := make([]interface{}, len(xs))
-
-		for idx, x := range xs {
-			z := x.(*msg)
-			is[idx] = z.d
+// NewFlow returns a flow made of the stages set by the options, in this order:
+//
+//    extractor    - extracts the metadata of each element, see WithExtractor
+//    filters      - drop the elements rejected by any filter, see WithFilter
+//    grouping     - groups the elements by key over a window, see WithGrouping
+//    group filter - drop the groups rejected by any group filter, see WithGroupFilter
+//
+// Every stage is optional. Without extractor, byte slices get empty metadata
+// and records keep theirs. Without grouping, the group filters are called with
+// each element on its own.
+//
+// Every stage runs in parallel, which reorders the elements unless an
+// Ordering is set with WithOrdering.
+//
+// A panic in any of the functions is recovered, the offending element is
+// handed to the PanicHandler (see WithPanicHandler) and dropped.
+//
+//    f := NewFlow(
+//        WithExtractor(parseJSON),
+//        WithGrouping(func(md Metadata) string { return md["uuid"] }),
+//        WithWindow(5*time.Second),
+//    )
+//    w := nbw.NewStreamWriter(os.Stdout, f)
+func NewFlow(opts ...Option) streams.Flow {
+	c := newConfig(opts)
+
+	flows := []streams.Flow{
+		// the elements whose extraction panicked are dropped right away
+		c.newFlatMap(toMapFunc(c.extractor, c.onPanic), OrderPerGroup),
+	}
+
+	if len(c.filters) > 0 {
+		flows = append(flows, c.newFilter(toFilterFunc(c.filters, c.onPanic), OrderPerGroup))
+	}
+
+	if c.grouping == nil {
+		if len(c.groupFilters) > 0 {
+			flows = append(flows, c.newFilter(toSingleGroupFilterFunc(c.groupFilters, c.onPanic), OrderPerGroup))
 		}
 
-		return is
-	}, p)
+		return NewPipe(append(flows, c.newMap(fromMsg, OrderPerGroup))...)
+	}
 
-	return NewPipe(m1, f1, a, m2, f2, fm)
+	a := NewAggregator(toGroupFunc(c.grouping), c.bundlerOpts...)
+	a.PanicF = func(elem interface{}, v interface{}) {
+		c.onPanic(elem.(*msg).d, v)
+	}
+	flows = append(flows, a, c.newMap(toXmsg, OrderGlobal))
+
+	if len(c.groupFilters) > 0 {
+		flows = append(flows, c.newFilter(toGroupFilterFunc(c.groupFilters, c.onPanic), OrderGlobal))
+	}
+
+	return NewPipe(append(flows, c.newFlatMap(fromXmsg, OrderGlobal))...)
 }
 
-func toMapFunc(fn MapFn) flow.MapFunc {
-	return func(i interface{}) interface{} {
-		d := i.([]byte)
-		md, d := fn(d)
+func toXmsg(i interface{}) interface{} {
+	xs := i.([]interface{})
+	mds := make([]Metadata, len(xs))
+	for idx, x := range xs {
+		y := x.(*msg)
+		mds[idx] = y.md
+	}
+
+	return &xmsg{
+		mds: mds,
+		d:   xs,
+	}
+}
 
-		m := &msg{md: md, d: d}
+func fromXmsg(i interface{}) []interface{} {
+	y := i.(*xmsg)
+	xs := y.d.([]interface{})
+	is := make([]interface{}, len(xs))
 
-		return m
+	for idx, x := range xs {
+		z := x.(*msg)
+		is[idx] = z.d
+	}
+
+	return is
+}
+
+func fromMsg(i interface{}) interface{} {
+	return i.(*msg).d
+}
+
+func toMapFunc(fn MapFn, h PanicHandler) flow.FlatMapFunc {
+	return func(i interface{}) []interface{} {
+		// a recovered element yields no message
+		failed := false
+		defer RecoverPanic(h, i, &failed)
+
+		md, d, _ := extract(i, fn)
+
+		return []interface{}{&msg{md: md, d: d}}
 	}
 }
 
@@ -80,20 +156,58 @@ func toGroupFunc(fn GroupFn) GroupFunc {
 	}
 }
 
-func toFilterFunc(fn FilterFn) flow.FilterFunc {
+func toFilterFunc(fns []FilterFn, h PanicHandler) flow.FilterFunc {
 	return func(i interface{}) bool {
 		x := i.(*msg)
-		r := fn(x.md)
 
-		return r
+		failed := false
+		defer RecoverPanic(h, x.d, &failed)
+
+		for _, fn := range fns {
+			if !fn(x.md) {
+				return false
+			}
+		}
+
+		return true
 	}
 }
 
-func toGroupFilterFunc(fn GroupFilterFn) flow.FilterFunc {
+func toGroupFilterFunc(fns []GroupFilterFn, h PanicHandler) flow.FilterFunc {
 	return func(i interface{}) bool {
 		x := i.(*xmsg)
-		r := fn(x.mds)
 
-		return r
+		failed := false
+		defer RecoverPanic(func(_ interface{}, v interface{}) {
+			// every element of the group is dropped
+			for _, e := range x.d.([]interface{}) {
+				h(e.(*msg).d, v)
+			}
+		}, x, &failed)
+
+		for _, fn := range fns {
+			if !fn(x.mds) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+func toSingleGroupFilterFunc(fns []GroupFilterFn, h PanicHandler) flow.FilterFunc {
+	return func(i interface{}) bool {
+		x := i.(*msg)
+
+		failed := false
+		defer RecoverPanic(h, x.d, &failed)
+
+		for _, fn := range fns {
+			if !fn([]Metadata{x.md}) {
+				return false
+			}
+		}
+
+		return true
 	}
 }
@@ -0,0 +1,199 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/reugn/go-streams"
+
+	ext "github.com/reugn/go-streams/extension"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlow(t *testing.T) {
+	level := func(i []byte) (Metadata, []byte) {
+		var obj map[string]string
+		_ = json.Unmarshal(i, &obj)
+
+		return Metadata{"uuid": obj["uuid"], "level": obj["level"]}, i
+	}
+
+	var _input = []string{
+		`{"uuid":"ID001","level":"debug"}`,
+		`{"uuid":"ID001","level":"info"}`,
+		`{"uuid":"ID002","level":"warn"}`,
+		`{"uuid":"ID002","level":"error"}`,
+		`{"uuid":"ID003","level":"info"}`,
+	}
+
+	tests := []struct {
+		flow streams.Flow
+		want []string
+	}{
+		{
+			// no stage
+			flow: NewFlow(),
+			want: _input,
+		},
+		{
+			// chained filters
+			flow: NewFlow(
+				WithExtractor(level),
+				WithFilter(func(md Metadata) bool { return md["level"] != "debug" }),
+				WithFilter(func(md Metadata) bool { return md["uuid"] != "ID003" }),
+				WithOrdering(OrderGlobal),
+			),
+			want: _input[1:4],
+		},
+		{
+			// grouping and group filter only
+			flow: NewFlow(
+				WithExtractor(level),
+				WithGrouping(func(md Metadata) string { return md["uuid"] }),
+				WithGroupFilter(func(mds []Metadata) bool { return len(mds) > 1 }),
+				WithWindow(time.Hour),
+			),
+			want: _input[:4],
+		},
+	}
+
+	for _, tt := range tests {
+		assert.ElementsMatch(t, tt.want, runFlow(tt.flow, _input))
+	}
+}
+
+func TestFlowParallelism(t *testing.T) {
+	_input := []string{"a", "b", "c"}
+
+	// a parallelism of 0 still runs one worker per stage
+	flow := NewFlow(
+		WithFilter(func(md Metadata) bool { return true }),
+		WithGroupFilter(func(mds []Metadata) bool { return true }),
+		WithParallelism(0),
+	)
+
+	assert.ElementsMatch(t, _input, runFlow(flow, _input))
+}
+
+func runFlow(flow streams.Flow, input []string) []string {
+	in := make(chan interface{})
+	out := make(chan interface{})
+
+	source := ext.NewChanSource(in)
+	sink := ext.NewChanSink(out)
+
+	go func() {
+		for _, msg := range input {
+			in <- []byte(msg)
+		}
+		close(in)
+	}()
+	go func() {
+		source.
+			Via(flow).
+			To(sink)
+	}()
+
+	var output []string
+	for e := range sink.Out {
+		p, _ := payload(e)
+		output = append(output, string(p))
+	}
+
+	return output
+}
+
+func TestFlowPanics(t *testing.T) {
+	in := make(chan interface{})
+	out := make(chan interface{})
+
+	deadLetter := &bytes.Buffer{}
+	lock := &sync.Mutex{}
+	before := RecoveredPanics()
+
+	flow := NewFlow(
+		WithExtractor(func(i []byte) (Metadata, []byte) {
+			var obj map[string]interface{}
+			_ = json.Unmarshal(i, &obj)
+
+			// panics when uuid is not a string
+			return Metadata{"uuid": obj["uuid"].(string)}, i
+		}),
+		WithFilter(func(md Metadata) bool {
+			if md["uuid"] == "filter" {
+				panic("filter")
+			}
+
+			return true
+		}),
+		WithGrouping(func(md Metadata) string {
+			if md["uuid"] == "group" {
+				panic("group")
+			}
+
+			return md["uuid"]
+		}),
+		WithPanicHandler(func(elem interface{}, v interface{}) {
+			lock.Lock()
+			defer lock.Unlock()
+			DeadLetter(deadLetter)(elem, v)
+		}),
+	)
+
+	source := ext.NewChanSource(in)
+	sink := ext.NewChanSink(out)
+
+	go func() {
+		for _, msg := range []string{`{"uuid":"ID001"}`, `{"uuid":1}`, `{"uuid":"filter"}`, `{"uuid":"group"}`} {
+			in <- []byte(msg)
+		}
+		close(in)
+	}()
+	go func() {
+		source.
+			Via(flow).
+			To(sink)
+	}()
+
+	var _output []string
+	for e := range sink.Out {
+		_output = append(_output, string(e.([]byte)))
+	}
+
+	assert.Equal(t, []string{`{"uuid":"ID001"}`}, _output)
+	assert.Equal(t, uint64(3), RecoveredPanics()-before)
+	assert.Len(t, deadLetter.String(), len(`{"uuid":1}{"uuid":"filter"}{"uuid":"group"}`))
+}
+
+func TestFlowNilPanicHandler(t *testing.T) {
+	before := RecoveredPanics()
+
+	flow := NewFlow(
+		WithGrouping(func(md Metadata) string { return "" }),
+		WithGroupFilter(func(mds []Metadata) bool { panic("group filter") }),
+		WithPanicHandler(nil),
+	)
+
+	assert.Empty(t, runFlow(flow, []string{"a", "b"}))
+	assert.Equal(t, uint64(1), RecoveredPanics()-before)
+}
+
+func TestFlowExtractorPanics(t *testing.T) {
+	extractor := WithExtractor(func(i []byte) (Metadata, []byte) {
+		if string(i) == "panic" {
+			panic("extractor")
+		}
+
+		return Metadata{"uuid": string(i)}, i
+	})
+
+	for _, flow := range []streams.Flow{
+		NewFlow(extractor),
+		NewFlow(extractor, WithGrouping(func(md Metadata) string { return md["uuid"] })),
+	} {
+		assert.ElementsMatch(t, []string{"a", "b"}, runFlow(flow, []string{"a", "panic", "b"}))
+	}
+}
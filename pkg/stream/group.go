@@ -37,8 +37,12 @@ type wrappedElement struct {
 //    [---------- AggregatorFunc --------]
 //                    |               |
 // out --------------[1,2,3]---------[4,5] --
+//
+// A panic in GroupF is recovered, the offending element is handed to PanicF
+// and dropped.
 type Aggregator struct {
 	GroupF      GroupFunc
+	PanicF      PanicHandler
 	in          chan interface{}
 	out         chan interface{}
 	evict       chan string
@@ -105,7 +109,7 @@ func (a *Aggregator) transmit(inlet streams.Inlet) {
 func (a *Aggregator) receive() {
 	// read from the input channel
 	for elem := range a.in {
-		a.store(a.GroupF(elem), elem)
+		a.group(elem)
 	}
 	keys := make([]string, 0)
 
@@ -133,6 +137,13 @@ func (a *Aggregator) receive() {
 	close(a.out)
 }
 
+func (a *Aggregator) group(elem interface{}) {
+	failed := false
+	defer RecoverPanic(a.PanicF, elem, &failed)
+
+	a.store(a.GroupF(elem), elem)
+}
+
 func (a *Aggregator) store(k string, e interface{}) {
 	we := &wrappedElement{key: k, data: e}
 	b := a.getBundler(k)
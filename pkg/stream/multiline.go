@@ -0,0 +1,182 @@
+package stream
+
+import (
+	"bytes"
+	"regexp"
+	"time"
+
+	"github.com/reugn/go-streams"
+)
+
+const (
+	DefaultMultiLineTimeout  = 500 * time.Millisecond
+	DefaultMultiLineMaxLines = 500
+)
+
+// MultiLineOption can be used to setup the assembler.
+type MultiLineOption func(*MultiLine)
+
+// WithMultiLineTimeout sets how long a record waits for a continuation line
+// before being emitted. The default is DefaultMultiLineTimeout.
+func WithMultiLineTimeout(d time.Duration) MultiLineOption {
+	return MultiLineOption(func(m *MultiLine) {
+		m.timeout = d
+	})
+}
+
+// WithMaxLines sets the maximum number of lines of a record, the record is
+// emitted once it is reached. The default is DefaultMultiLineMaxLines.
+func WithMaxLines(n int) MultiLineOption {
+	return MultiLineOption(func(m *MultiLine) {
+		m.maxLines = n
+	})
+}
+
+// MultiLine assembles the lines of multi-line records, such as stack traces,
+// into single records. Each byte slice is split into lines, a line matching
+// the start regular expression begins a new record and the other lines are
+// appended to the current one. A record is emitted when the next one begins,
+// when no line arrived for the timeout or when it reaches the maximum number
+// of lines.
+//
+// in  -- panic: boom -- \tmain.go:12 -- panic: again --
+//             |               |              |
+//    [------------------ MultiLine -------------------]
+//                                            |
+// out ------------------------- panic: boom\n\tmain.go:12 --
+//
+// Records are passed as is, after the current record.
+//
+// The input must be line framed: a line split across two byte slices is seen
+// as two lines. When the producer writes arbitrary chunks, e.g. through
+// io.Copy, enable the line splitting of the stream writer (WithLineSplitting)
+// in front of the MultiLine.
+type MultiLine struct {
+	in       chan interface{}
+	out      chan interface{}
+	start    *regexp.Regexp
+	timeout  time.Duration
+	maxLines int
+	buf      *bytes.Buffer
+	lines    int
+}
+
+// NewMultiLine returns a new MultiLine instance.
+// start matches the first line of a record, e.g. `^\S` for records whose
+// continuation lines are indented.
+func NewMultiLine(start *regexp.Regexp, opts ...MultiLineOption) *MultiLine {
+	m := &MultiLine{
+		in:       make(chan interface{}),
+		out:      make(chan interface{}),
+		start:    start,
+		timeout:  DefaultMultiLineTimeout,
+		maxLines: DefaultMultiLineMaxLines,
+		buf:      &bytes.Buffer{},
+	}
+
+	for _, o := range opts {
+		o(m)
+	}
+
+	go m.receive()
+
+	return m
+}
+
+// Via streams data through the given flow
+func (m *MultiLine) Via(flow streams.Flow) streams.Flow {
+	go m.transmit(flow)
+	return flow
+}
+
+// To streams data to the given sink
+func (m *MultiLine) To(sink streams.Sink) {
+	m.transmit(sink)
+}
+
+// Out returns an output channel for sending data
+func (m *MultiLine) Out() <-chan interface{} {
+	return m.out
+}
+
+// In returns an input channel for receiving data
+func (m *MultiLine) In() chan<- interface{} {
+	return m.in
+}
+
+func (m *MultiLine) transmit(inlet streams.Inlet) {
+	for elem := range m.Out() {
+		inlet.In() <- elem
+	}
+	close(inlet.In())
+}
+
+func (m *MultiLine) receive() {
+	var timeout <-chan time.Time
+
+	for {
+		select {
+		case elem, ok := <-m.in:
+			if !ok {
+				m.flush()
+				close(m.out)
+
+				return
+			}
+
+			m.add(elem)
+
+			timeout = nil
+			if m.lines > 0 {
+				timeout = time.After(m.timeout)
+			}
+		case <-timeout:
+			m.flush()
+			timeout = nil
+		}
+	}
+}
+
+func (m *MultiLine) add(elem interface{}) {
+	p, ok := elem.([]byte)
+	if !ok {
+		m.flush()
+		m.out <- elem
+
+		return
+	}
+
+	for _, line := range bytes.SplitAfter(p, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+
+		if m.start.Match(bytes.TrimRight(line, "\r\n")) {
+			m.flush()
+		}
+
+		m.buf.Write(line)
+		if line[len(line)-1] != '\n' {
+			m.buf.WriteByte('\n')
+		}
+		m.lines++
+
+		if m.lines >= m.maxLines {
+			m.flush()
+		}
+	}
+}
+
+// flush emits the current record, if any.
+func (m *MultiLine) flush() {
+	if m.lines == 0 {
+		return
+	}
+
+	p := make([]byte, m.buf.Len())
+	copy(p, m.buf.Bytes())
+	m.buf.Reset()
+	m.lines = 0
+
+	m.out <- p
+}
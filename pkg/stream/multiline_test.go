@@ -0,0 +1,49 @@
+package stream
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiLine(t *testing.T) {
+	_input := []string{
+		"2020-10-20 12:00:00 ERROR panic: boom\n",
+		"goroutine 1 [running]:\nmain.main()\n",
+		"\t/app/main.go:12 +0x25\n",
+		"2020-10-20 12:00:01 INFO started\n2020-10-20 12:00:01 INFO listening on :8080\n",
+		"2020-10-20 12:00:02 ERROR java.lang.NullPointerException\n",
+		"    at Main.run(Main.java:7)",
+	}
+
+	m := NewMultiLine(regexp.MustCompile(`^\d{4}-\d{2}-\d{2} `), WithMultiLineTimeout(time.Hour))
+
+	want := []string{
+		"2020-10-20 12:00:00 ERROR panic: boom\ngoroutine 1 [running]:\nmain.main()\n\t/app/main.go:12 +0x25\n",
+		"2020-10-20 12:00:01 INFO started\n",
+		"2020-10-20 12:00:01 INFO listening on :8080\n",
+		"2020-10-20 12:00:02 ERROR java.lang.NullPointerException\n    at Main.run(Main.java:7)\n",
+	}
+
+	assert.Equal(t, want, runFlow(m, _input))
+}
+
+func TestMultiLineTimeout(t *testing.T) {
+	m := NewMultiLine(regexp.MustCompile(`^\S`), WithMultiLineTimeout(10*time.Millisecond))
+
+	m.In() <- []byte("panic: boom\n")
+	m.In() <- []byte("\tmain.go:12\n")
+
+	select {
+	case e := <-m.Out():
+		assert.Equal(t, "panic: boom\n\tmain.go:12\n", string(e.([]byte)))
+	case <-time.After(time.Second):
+		t.Fatal("record not emitted after the timeout")
+	}
+
+	close(m.In())
+	_, ok := <-m.Out()
+	assert.False(t, ok)
+}
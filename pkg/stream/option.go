@@ -0,0 +1,159 @@
+package stream
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/reugn/go-streams"
+	"github.com/reugn/go-streams/flow"
+
+	bbx "github.com/BinaryHexer/nbw/pkg/bundler"
+)
+
+// Ordering tells which order of the elements the flows built by NewFlow preserve.
+type Ordering int
+
+const (
+	// OrderNone lets the parallel stages reorder the elements. It is the fastest.
+	OrderNone Ordering = iota
+	// OrderPerGroup preserves the order of the elements within each group, while
+	// the groups may be emitted in any order.
+	OrderPerGroup
+	// OrderGlobal preserves the order of the elements within each group, and the
+	// groups are emitted in the order they are complete.
+	OrderGlobal
+)
+
+// Option can be used to setup the flows built by NewFlow and NewBasicFlow.
+type Option func(*config)
+
+type config struct {
+	extractor    MapFn
+	filters      []FilterFn
+	grouping     GroupFn
+	groupFilters []GroupFilterFn
+
+	bundlerOpts []bbx.Option
+	onPanic     PanicHandler
+	parallelism uint
+	ordering    Ordering
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{
+		onPanic:     logPanic,
+		parallelism: uint(runtime.NumCPU()),
+		ordering:    OrderNone,
+	}
+
+	for _, o := range opts {
+		o(c)
+	}
+
+	return c
+}
+
+// WithExtractor sets the function extracting the metadata of the byte slices.
+// Records keep their metadata.
+func WithExtractor(fn MapFn) Option {
+	return Option(func(c *config) {
+		c.extractor = fn
+	})
+}
+
+// WithFilter adds a function dropping the elements it rejects. Filters are
+// called in the order they are added, until one rejects the element.
+func WithFilter(fn FilterFn) Option {
+	return Option(func(c *config) {
+		if fn != nil {
+			c.filters = append(c.filters, fn)
+		}
+	})
+}
+
+// WithGrouping sets the function returning the key by which the elements are grouped.
+func WithGrouping(fn GroupFn) Option {
+	return Option(func(c *config) {
+		c.grouping = fn
+	})
+}
+
+// WithGroupFilter adds a function dropping the groups it rejects. Group
+// filters are called in the order they are added, until one rejects the group.
+func WithGroupFilter(fn GroupFilterFn) Option {
+	return Option(func(c *config) {
+		if fn != nil {
+			c.groupFilters = append(c.groupFilters, fn)
+		}
+	})
+}
+
+// WithWindow sets the duration over which the elements are grouped before
+// the group is emitted. The default is DefaultDelayThreshold.
+func WithWindow(d time.Duration) Option {
+	return Option(func(c *config) {
+		c.bundlerOpts = append(c.bundlerOpts, bbx.WithDelayThreshold(d))
+	})
+}
+
+// WithBundlerOptions sets the options of the bundlers grouping the elements.
+func WithBundlerOptions(opts ...bbx.Option) Option {
+	return Option(func(c *config) {
+		c.bundlerOpts = append(c.bundlerOpts, opts...)
+	})
+}
+
+// WithPanicHandler sets the function called with the elements whose
+// processing panicked. The default is a simple log, which is kept if h is nil.
+func WithPanicHandler(h PanicHandler) Option {
+	return Option(func(c *config) {
+		if h != nil {
+			c.onPanic = h
+		}
+	})
+}
+
+// WithParallelism sets the number of elements processed at once by each stage,
+// at least 1. The default is runtime.NumCPU().
+func WithParallelism(n uint) Option {
+	return Option(func(c *config) {
+		if n < 1 {
+			n = 1
+		}
+		c.parallelism = n
+	})
+}
+
+// WithOrdering sets the order of the elements preserved by the flow, the
+// elements are still processed in parallel. The default is OrderNone.
+func WithOrdering(o Ordering) Option {
+	return Option(func(c *config) {
+		c.ordering = o
+	})
+}
+
+// newMap, newFilter and newFlatMap return parallel stages preserving the order
+// of the elements if c.ordering is at least o.
+func (c *config) newMap(fn flow.MapFunc, o Ordering) streams.Flow {
+	if c.ordering >= o {
+		return NewOrderedMap(fn, c.parallelism)
+	}
+
+	return flow.NewMap(fn, c.parallelism)
+}
+
+func (c *config) newFilter(fn flow.FilterFunc, o Ordering) streams.Flow {
+	if c.ordering >= o {
+		return NewOrderedFilter(fn, c.parallelism)
+	}
+
+	return flow.NewFilter(fn, c.parallelism)
+}
+
+func (c *config) newFlatMap(fn flow.FlatMapFunc, o Ordering) streams.Flow {
+	if c.ordering >= o {
+		return NewOrderedFlatMap(fn, c.parallelism)
+	}
+
+	return flow.NewFlatMap(fn, c.parallelism)
+}
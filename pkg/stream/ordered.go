@@ -0,0 +1,153 @@
+package stream
+
+import (
+	"sync"
+
+	"github.com/reugn/go-streams"
+	"github.com/reugn/go-streams/flow"
+)
+
+// Ordered applies a transformation function to the incoming elements in
+// parallel, while emitting the results in the order of the elements.
+// Each element produces zero, one or more elements.
+//
+// in  -- 1 -- 2 ---- 3 -- 4 ------ 5 --
+//        |    |      |    |        |
+//    [--------- OrderedFunc -----------]
+//        |    |      |    |        |
+// out -- 1' - 2' --- 3' - 4' ----- 5' -
+//
+// At most parallelism elements are transformed at once, and results are held
+// back for at most 2*parallelism elements waiting on a slower one.
+type Ordered struct {
+	fn          flow.FlatMapFunc
+	in          chan interface{}
+	out         chan interface{}
+	parallelism uint
+}
+
+type orderedResult struct {
+	seq   uint64
+	elems []interface{}
+}
+
+// NewOrderedMap returns an Ordered instance mapping each element with mapFunc.
+func NewOrderedMap(mapFunc flow.MapFunc, parallelism uint) *Ordered {
+	return newOrdered(func(i interface{}) []interface{} {
+		return []interface{}{mapFunc(i)}
+	}, parallelism)
+}
+
+// NewOrderedFilter returns an Ordered instance dropping the elements rejected by filterFunc.
+func NewOrderedFilter(filterFunc flow.FilterFunc, parallelism uint) *Ordered {
+	return newOrdered(func(i interface{}) []interface{} {
+		if filterFunc(i) {
+			return []interface{}{i}
+		}
+
+		return nil
+	}, parallelism)
+}
+
+// NewOrderedFlatMap returns an Ordered instance transforming each element into
+// zero or more elements with flatMapFunc.
+func NewOrderedFlatMap(flatMapFunc flow.FlatMapFunc, parallelism uint) *Ordered {
+	return newOrdered(flatMapFunc, parallelism)
+}
+
+func newOrdered(fn flow.FlatMapFunc, parallelism uint) *Ordered {
+	if parallelism == 0 {
+		parallelism = 1
+	}
+
+	o := &Ordered{
+		fn:          fn,
+		in:          make(chan interface{}),
+		out:         make(chan interface{}),
+		parallelism: parallelism,
+	}
+
+	go o.doStream()
+
+	return o
+}
+
+// Via streams data through the given flow
+func (o *Ordered) Via(flow streams.Flow) streams.Flow {
+	go o.transmit(flow)
+	return flow
+}
+
+// To streams data to the given sink
+func (o *Ordered) To(sink streams.Sink) {
+	o.transmit(sink)
+}
+
+// Out returns an output channel for sending data
+func (o *Ordered) Out() <-chan interface{} {
+	return o.out
+}
+
+// In returns an input channel for receiving data
+func (o *Ordered) In() chan<- interface{} {
+	return o.in
+}
+
+func (o *Ordered) transmit(inlet streams.Inlet) {
+	for elem := range o.Out() {
+		inlet.In() <- elem
+	}
+	close(inlet.In())
+}
+
+func (o *Ordered) doStream() {
+	// window bounds the elements in flight, including the results held back
+	window := make(chan struct{}, 2*o.parallelism)
+	sem := make(chan struct{}, o.parallelism)
+	results := make(chan orderedResult)
+	wg := &sync.WaitGroup{}
+
+	go o.emit(results, window)
+
+	var seq uint64
+	for elem := range o.in {
+		window <- struct{}{}
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func(seq uint64, e interface{}) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results <- orderedResult{seq: seq, elems: o.fn(e)}
+		}(seq, elem)
+		seq++
+	}
+
+	wg.Wait()
+	close(results)
+}
+
+func (o *Ordered) emit(results <-chan orderedResult, window <-chan struct{}) {
+	var next uint64
+	pending := make(map[uint64][]interface{})
+
+	for r := range results {
+		pending[r.seq] = r.elems
+
+		for {
+			elems, ok := pending[next]
+			if !ok {
+				break
+			}
+
+			for _, e := range elems {
+				o.out <- e
+			}
+			delete(pending, next)
+			<-window
+			next++
+		}
+	}
+
+	close(o.out)
+}
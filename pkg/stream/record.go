@@ -0,0 +1,49 @@
+package stream
+
+// Record is a log record along with the metadata already extracted from it,
+// e.g. by a logger integration. Records are written with WriteRecord and flow
+// through the pipeline next to the raw byte slices written with Write. The
+// flows of this package use the metadata of a Record as is, without calling
+// their MapFn, and the writers only write its payload.
+type Record struct {
+	Metadata Metadata
+	Payload  []byte
+}
+
+// A RecordWriter is a writer accepting records along with their metadata.
+type RecordWriter interface {
+	WriteRecord(md Metadata, p []byte) (int, error)
+}
+
+// extract returns the metadata and payload of an element, which is either a
+// Record or a byte slice whose metadata is extracted with fn. A nil fn yields
+// empty metadata, for pipelines fed with records only. ok is false for any
+// other element.
+func extract(elem interface{}, fn MapFn) (md Metadata, p []byte, ok bool) {
+	switch x := elem.(type) {
+	case *Record:
+		return x.Metadata, x.Payload, true
+	case []byte:
+		if fn == nil {
+			return Metadata{}, x, true
+		}
+		md, p = fn(x)
+
+		return md, p, true
+	default:
+		return nil, nil, false
+	}
+}
+
+// payload returns the bytes to write for an element, ok is false if the
+// element is neither a Record nor a byte slice.
+func payload(elem interface{}) (p []byte, ok bool) {
+	switch x := elem.(type) {
+	case *Record:
+		return x.Payload, true
+	case []byte:
+		return x, true
+	default:
+		return nil, false
+	}
+}
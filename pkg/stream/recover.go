@@ -0,0 +1,53 @@
+package stream
+
+import (
+	"io"
+	"log"
+	"sync/atomic"
+)
+
+//nolint:gochecknoglobals  // necessary to count the panics recovered by every flow
+var recovered uint64
+
+// PanicHandler is called with the element whose processing by a user
+// function panicked, and the value recovered from the panic. The element is
+// dropped from the flow once the handler returns.
+type PanicHandler func(elem interface{}, v interface{})
+
+// RecoveredPanics returns the number of panics recovered from user functions
+// since the program started.
+func RecoveredPanics() uint64 {
+	return atomic.LoadUint64(&recovered)
+}
+
+// DeadLetter returns a PanicHandler writing the offending byte slices and
+// records to w.
+func DeadLetter(w io.Writer) PanicHandler {
+	return func(elem interface{}, v interface{}) {
+		if p, ok := payload(elem); ok {
+			_, _ = w.Write(p)
+		}
+	}
+}
+
+func logPanic(elem interface{}, v interface{}) {
+	log.Printf("recovered from panic: %v\n", v)
+}
+
+// RecoverPanic must be deferred by the functions calling user functions, in
+// this package or in custom flows. It reports a panic to h, logging it if h is
+// nil, and sets failed to true.
+func RecoverPanic(h PanicHandler, elem interface{}, failed *bool) {
+	v := recover()
+	if v == nil {
+		return
+	}
+
+	atomic.AddUint64(&recovered, 1)
+	*failed = true
+
+	if h == nil {
+		h = logPanic
+	}
+	h(elem, v)
+}
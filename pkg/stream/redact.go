@@ -0,0 +1,369 @@
+package stream
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/reugn/go-streams"
+)
+
+const (
+	DefaultRedactMask = "[REDACTED]"
+)
+
+// RedactMode tells how a sensitive value is scrubbed.
+type RedactMode int
+
+const (
+	// RedactMask replaces the value with the mask.
+	RedactMask RedactMode = iota
+	// RedactHash replaces the value with the first 16 hex characters of its
+	// SHA-256, so that records can still be correlated. A plain hash of a
+	// low entropy value, e.g. an email or a card number, is easily reversed
+	// by brute force: it is not a secrecy control unless a secret key is set
+	// with WithRedactHashKey.
+	RedactHash
+	// RedactRemove removes the value, and its key for JSON keys.
+	RedactRemove
+)
+
+// CardNumberPattern matches 13 to 16 digits, possibly grouped with spaces or
+// dashes. Its matches are only scrubbed if they pass the Luhn check, so that
+// timestamps, identifiers or phone numbers are left untouched.
+//
+//nolint:gochecknoglobals  // patterns compiled once and shared by the redactors
+var (
+	EmailPattern      = regexp.MustCompile(`[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}`)
+	CardNumberPattern = regexp.MustCompile(`\b(?:\d[ \-]?){12,15}\d\b`)
+	TokenPattern      = regexp.MustCompile(`(?i)\bbearer\s+[a-z0-9\-._~+/]+=*`)
+)
+
+type keyRule struct {
+	path []string
+	mode RedactMode
+}
+
+type patternRule struct {
+	re    *regexp.Regexp
+	mode  RedactMode
+	valid func(m string) bool
+}
+
+// RedactOption can be used to setup the scrubber and the redactor.
+type RedactOption func(*Scrubber)
+
+// WithRedactKey scrubs the value of a JSON key. path is a dot separated path
+// of object keys such as "user.email", arrays are not traversed.
+func WithRedactKey(path string, mode RedactMode) RedactOption {
+	return RedactOption(func(r *Scrubber) {
+		r.keys = append(r.keys, keyRule{path: strings.Split(path, "."), mode: mode})
+	})
+}
+
+// WithRedactPattern scrubs every match of re, anywhere in the record.
+// See EmailPattern, CardNumberPattern and TokenPattern.
+func WithRedactPattern(re *regexp.Regexp, mode RedactMode) RedactOption {
+	return RedactOption(func(r *Scrubber) {
+		rule := patternRule{re: re, mode: mode}
+		if re == CardNumberPattern {
+			rule.valid = Luhn
+		}
+		r.patterns = append(r.patterns, rule)
+	})
+}
+
+// WithRedactMask sets the string replacing the values in RedactMask mode.
+// The default is DefaultRedactMask.
+func WithRedactMask(mask string) RedactOption {
+	return RedactOption(func(r *Scrubber) {
+		r.mask = mask
+	})
+}
+
+// WithRedactHashKey makes RedactHash use a HMAC-SHA256 keyed with key instead
+// of a plain SHA-256, so that the hashed values cannot be brute-forced without
+// the key. The key must be kept secret and stable to correlate records.
+func WithRedactHashKey(key []byte) RedactOption {
+	return RedactOption(func(r *Scrubber) {
+		r.hashKey = key
+	})
+}
+
+// Scrubber scrubs sensitive data from byte slices and metadata, outside of
+// any flow, e.g. in a writer. JSON records are scrubbed by key path, then
+// every record is scrubbed by regular expression, JSON or free text alike.
+// The top level keys of metadata are matched against the key paths.
+type Scrubber struct {
+	keys     []keyRule
+	patterns []patternRule
+	mask     string
+	hashKey  []byte
+}
+
+// NewScrubber returns a new Scrubber instance.
+func NewScrubber(opts ...RedactOption) *Scrubber {
+	r := &Scrubber{
+		mask: DefaultRedactMask,
+	}
+
+	for _, o := range opts {
+		o(r)
+	}
+
+	return r
+}
+
+// Redactor scrubs sensitive data from the elements flowing through it with a
+// Scrubber, the metadata of a Record being scrubbed as well.
+//
+// in  -- {"user":"a@b.co"} --
+//               |
+//    [------ Redactor ------]
+//               |
+// out -- {"user":"[REDACTED]"} --
+type Redactor struct {
+	*Scrubber
+	in  chan interface{}
+	out chan interface{}
+}
+
+// NewRedactor returns a new Redactor instance.
+func NewRedactor(opts ...RedactOption) *Redactor {
+	r := &Redactor{
+		Scrubber: NewScrubber(opts...),
+		in:       make(chan interface{}),
+		out:      make(chan interface{}),
+	}
+
+	go r.receive()
+
+	return r
+}
+
+// Via streams data through the given flow
+func (r *Redactor) Via(flow streams.Flow) streams.Flow {
+	go r.transmit(flow)
+	return flow
+}
+
+// To streams data to the given sink
+func (r *Redactor) To(sink streams.Sink) {
+	r.transmit(sink)
+}
+
+// Out returns an output channel for sending data
+func (r *Redactor) Out() <-chan interface{} {
+	return r.out
+}
+
+// In returns an input channel for receiving data
+func (r *Redactor) In() chan<- interface{} {
+	return r.in
+}
+
+func (r *Redactor) transmit(inlet streams.Inlet) {
+	for elem := range r.Out() {
+		inlet.In() <- elem
+	}
+	close(inlet.In())
+}
+
+func (r *Redactor) receive() {
+	for elem := range r.in {
+		switch x := elem.(type) {
+		case *Record:
+			r.out <- &Record{Metadata: r.RedactMetadata(x.Metadata), Payload: r.Redact(x.Payload)}
+		case []byte:
+			r.out <- r.Redact(x)
+		default:
+			r.out <- elem
+		}
+	}
+
+	close(r.out)
+}
+
+// Redact returns a scrubbed copy of p.
+func (r *Scrubber) Redact(p []byte) []byte {
+	q := append([]byte(nil), p...)
+	if len(r.keys) > 0 {
+		if obj, ok := r.redactJSON(bytes.TrimSpace(p), 0, r.keys); ok {
+			// keep the record terminator, if any
+			q = append(obj, p[len(bytes.TrimRight(p, " \t\r\n")):]...)
+		}
+	}
+
+	for _, rule := range r.patterns {
+		q = rule.re.ReplaceAllFunc(q, func(m []byte) []byte {
+			if rule.valid != nil && !rule.valid(string(m)) {
+				return m
+			}
+			return []byte(r.scrub(string(m), rule.mode))
+		})
+	}
+
+	return q
+}
+
+// RedactMetadata returns a scrubbed copy of md.
+func (r *Scrubber) RedactMetadata(md Metadata) Metadata {
+	rmd := make(Metadata, len(md))
+
+	for k, v := range md {
+		rmd[k] = v
+		for _, rule := range r.keys {
+			if len(rule.path) == 1 && rule.path[0] == k {
+				if rule.mode == RedactRemove {
+					delete(rmd, k)
+					break
+				}
+				rmd[k] = r.scrub(v, rule.mode)
+			}
+		}
+	}
+
+	for k, v := range rmd {
+		for _, rule := range r.patterns {
+			v = rule.re.ReplaceAllStringFunc(v, func(m string) string {
+				if rule.valid != nil && !rule.valid(m) {
+					return m
+				}
+				return r.scrub(m, rule.mode)
+			})
+		}
+		rmd[k] = v
+	}
+
+	return rmd
+}
+
+func (r *Scrubber) scrub(v string, mode RedactMode) string {
+	switch mode {
+	case RedactHash:
+		if r.hashKey == nil {
+			sum := sha256.Sum256([]byte(v))
+			return hex.EncodeToString(sum[:8])
+		}
+
+		h := hmac.New(sha256.New, r.hashKey)
+		_, _ = h.Write([]byte(v))
+
+		return hex.EncodeToString(h.Sum(nil)[:8])
+	case RedactRemove:
+		return ""
+	default:
+		return r.mask
+	}
+}
+
+// redactJSON rewrites the object p, keeping the order of its keys, with the
+// rules whose path matches at the given depth. ok is false if p is not an
+// object.
+func (r *Scrubber) redactJSON(p []byte, depth int, rules []keyRule) (obj []byte, ok bool) {
+	dec := json.NewDecoder(bytes.NewReader(p))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, false
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, false
+		}
+		key, _ := t.(string)
+
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, false
+		}
+
+		value, keep := r.redactValue(raw, key, depth, rules)
+		if !keep {
+			continue
+		}
+
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+
+	if t, err := dec.Token(); err != nil || t != json.Delim('}') {
+		return nil, false
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), true
+}
+
+func (r *Scrubber) redactValue(raw []byte, key string, depth int, rules []keyRule) (value []byte, keep bool) {
+	var nested []keyRule
+
+	for _, rule := range rules {
+		if rule.path[depth] != key {
+			continue
+		}
+
+		if len(rule.path) > depth+1 {
+			nested = append(nested, rule)
+			continue
+		}
+
+		if rule.mode == RedactRemove {
+			return nil, false
+		}
+
+		var s interface{}
+		_ = json.Unmarshal(raw, &s)
+		str, ok := s.(string)
+		if !ok {
+			str = string(raw)
+		}
+		value, _ = json.Marshal(r.scrub(str, rule.mode))
+
+		return value, true
+	}
+
+	if len(nested) > 0 {
+		if obj, ok := r.redactJSON(raw, depth+1, nested); ok {
+			return obj, true
+		}
+	}
+
+	return raw, true
+}
+
+// Luhn reports whether the digits of s, ignoring any other character, pass
+// the Luhn checksum of card numbers.
+func Luhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+
+	return n > 0 && sum%10 == 0
+}
@@ -0,0 +1,83 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactor(t *testing.T) {
+	tests := []struct {
+		opts  []RedactOption
+		input string
+		want  string
+	}{
+		{
+			// nested key, order preserved
+			opts:  []RedactOption{WithRedactKey("user.email", RedactMask)},
+			input: `{"msg":"login","user":{"id":7,"email":"a@b.co"}}` + "\n",
+			want:  `{"msg":"login","user":{"id":7,"email":"[REDACTED]"}}` + "\n",
+		},
+		{
+			opts:  []RedactOption{WithRedactKey("token", RedactRemove)},
+			input: `{"msg":"call","token":"s3cr3t","status":200}`,
+			want:  `{"msg":"call","status":200}`,
+		},
+		{
+			opts:  []RedactOption{WithRedactKey("user", RedactHash)},
+			input: `{"user":"alice"}`,
+			want:  `{"user":"2bd806c97f0e00af"}`,
+		},
+		{
+			opts:  []RedactOption{WithRedactKey("user", RedactHash), WithRedactHashKey([]byte("secret"))},
+			input: `{"user":"alice"}`,
+			want:  `{"user":"4360c67bc8102511"}`,
+		},
+		{
+			// free text
+			opts: []RedactOption{
+				WithRedactPattern(EmailPattern, RedactMask),
+				WithRedactPattern(CardNumberPattern, RedactMask),
+				WithRedactPattern(TokenPattern, RedactRemove),
+			},
+			input: "mail a@b.co paid with 4111 1111 1111 1111 using Bearer abc.def",
+			want:  "mail [REDACTED] paid with [REDACTED] using ",
+		},
+		{
+			// numbers failing the Luhn check are not card numbers
+			opts:  []RedactOption{WithRedactPattern(CardNumberPattern, RedactMask)},
+			input: `{"ts":1700000000000,"order":"4111-1111-1111-1112","card":"4012888888881881"}`,
+			want:  `{"ts":1700000000000,"order":"4111-1111-1111-1112","card":"[REDACTED]"}`,
+		},
+		{
+			// not JSON, key rules are ignored
+			opts:  []RedactOption{WithRedactKey("user", RedactMask), WithRedactMask("***")},
+			input: `user=alice`,
+			want:  `user=alice`,
+		},
+	}
+
+	for _, tt := range tests {
+		r := NewRedactor(tt.opts...)
+		assert.Equal(t, tt.want, string(r.Redact([]byte(tt.input))))
+	}
+}
+
+func TestRedactorFlow(t *testing.T) {
+	_input := []string{
+		`{"level":"info","msg":"hello a@b.co"}`,
+		`{"level":"info","email":"a@b.co"}`,
+	}
+
+	r := NewRedactor(
+		WithRedactKey("email", RedactRemove),
+		WithRedactPattern(EmailPattern, RedactMask),
+	)
+
+	want := []string{
+		`{"level":"info","msg":"hello [REDACTED]"}`,
+		`{"level":"info"}`,
+	}
+
+	assert.ElementsMatch(t, want, runFlow(r, _input))
+}
@@ -0,0 +1,170 @@
+package stream
+
+import (
+	"io"
+	"log"
+
+	"github.com/reugn/go-streams"
+)
+
+// Router routes each incoming element to one of several named inlets.
+// The metadata of the element is extracted using a MapFn, or taken from the
+// Record, and the name of the route is returned by a GroupFn over that
+// metadata. Elements without a matching route are passed downstream, which
+// acts as the default route.
+//
+//   eg:
+//    RouteF(1,3) = a
+//    RouteF(4)   = b
+//
+// in  -- 1 -- 2 -- 3 -- 4 -- 5 --
+//        |    |    |    |    |
+//    [--------- Router ---------] -- 1 -- 3 --> a
+//             |         |    |    -- 4 ------> b
+//             |         |    |
+// out ------- 2 ------------ 5 --
+//
+// The routes are fed synchronously, so each of them must keep consuming its
+// input, e.g. by being connected to a sink or be a WriterSink.
+//
+// A panic in MapF or RouteF is recovered, the offending element is handed to
+// PanicF and dropped.
+type Router struct {
+	MapF   MapFn
+	RouteF GroupFn
+	PanicF PanicHandler
+	in     chan interface{}
+	out    chan interface{}
+	routes map[string]streams.Inlet
+}
+
+// NewRouter returns a new Router instance.
+// mapFunc extracts the metadata of an element, it can be nil if only records are
+// written. routeFunc returns the name of its route.
+// The routes are closed once the Router input is closed.
+func NewRouter(mapFunc MapFn, routeFunc GroupFn, routes map[string]streams.Inlet) *Router {
+	r := &Router{
+		MapF:   mapFunc,
+		RouteF: routeFunc,
+		in:     make(chan interface{}),
+		out:    make(chan interface{}),
+		routes: routes,
+	}
+
+	go r.receive()
+
+	return r
+}
+
+// Via streams data through the given flow
+func (r *Router) Via(flow streams.Flow) streams.Flow {
+	go r.transmit(flow)
+	return flow
+}
+
+// To streams data to the given sink
+func (r *Router) To(sink streams.Sink) {
+	r.transmit(sink)
+}
+
+// Out returns an output channel for sending data
+func (r *Router) Out() <-chan interface{} {
+	return r.out
+}
+
+// In returns an input channel for receiving data
+func (r *Router) In() chan<- interface{} {
+	return r.in
+}
+
+func (r *Router) transmit(inlet streams.Inlet) {
+	for elem := range r.Out() {
+		inlet.In() <- elem
+	}
+	close(inlet.In())
+}
+
+func (r *Router) receive() {
+	for elem := range r.in {
+		inlet, ok, failed := r.route(elem)
+		switch {
+		case failed:
+			continue
+		case ok:
+			inlet.In() <- elem
+		default:
+			r.out <- elem
+		}
+	}
+
+	for _, inlet := range r.routes {
+		close(inlet.In())
+	}
+	close(r.out)
+}
+
+func (r *Router) route(elem interface{}) (inlet streams.Inlet, ok bool, failed bool) {
+	defer RecoverPanic(r.PanicF, elem, &failed)
+
+	md, _, ok := extract(elem, r.MapF)
+	if !ok {
+		return nil, false, false
+	}
+
+	inlet, ok = r.routes[r.RouteF(md)]
+
+	return inlet, ok, false
+}
+
+// WriterSink is a sink writing the incoming byte slices and records to an io.Writer,
+// typically one of the nbw writers.
+type WriterSink struct {
+	w    io.Writer
+	in   chan interface{}
+	done chan struct{}
+}
+
+// NewWriterSink returns a new WriterSink instance.
+// w is closed, if io.Closer is implemented, once the sink input is closed.
+func NewWriterSink(w io.Writer) *WriterSink {
+	s := &WriterSink{
+		w:    w,
+		in:   make(chan interface{}),
+		done: make(chan struct{}),
+	}
+
+	go s.write()
+
+	return s
+}
+
+// In returns an input channel for receiving data
+func (s *WriterSink) In() chan<- interface{} {
+	return s.in
+}
+
+// Done returns a channel closed once all the data has been written.
+func (s *WriterSink) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *WriterSink) write() {
+	defer close(s.done)
+
+	for elem := range s.in {
+		p, ok := payload(elem)
+		if !ok {
+			continue
+		}
+
+		if _, err := s.w.Write(p); err != nil {
+			log.Printf("err occurred: %v\n", err)
+		}
+	}
+
+	if w, ok := s.w.(io.Closer); ok {
+		if err := w.Close(); err != nil {
+			log.Printf("err occurred: %v\n", err)
+		}
+	}
+}
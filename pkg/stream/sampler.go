@@ -0,0 +1,213 @@
+package stream
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/reugn/go-streams"
+)
+
+const (
+	DefaultSamplerMaxKeys = 4096
+	DefaultSamplerTick    = time.Second
+
+	// SamplerOverflowKey is the key shared by the keys seen once the
+	// maximum number of keys is reached within a tick.
+	SamplerOverflowKey = "_overflow"
+)
+
+// SummaryFunc returns the record emitted at the end of a tick for a key whose
+// records were suppressed.
+type SummaryFunc func(key string, suppressed uint64, tick time.Duration) *Record
+
+// SamplerOption can be used to setup the sampler.
+type SamplerOption func(*Sampler)
+
+// WithMaxKeys sets the maximum number of keys sampled independently within a
+// tick, the records of the other keys are sampled together under
+// SamplerOverflowKey. The default is DefaultSamplerMaxKeys.
+func WithMaxKeys(n int) SamplerOption {
+	return SamplerOption(func(s *Sampler) {
+		s.maxKeys = n
+	})
+}
+
+// WithSummary sets the function building the summary records.
+// The default is a JSON warning, see DefaultSummary.
+func WithSummary(fn SummaryFunc) SamplerOption {
+	return SamplerOption(func(s *Sampler) {
+		s.summary = fn
+	})
+}
+
+type sampleCount struct {
+	n          uint64
+	suppressed uint64
+}
+
+// Sampler samples the incoming elements per key, the same way zap's sampler
+// does per message: within each tick, the first records of a key are passed
+// downstream, then one out of every thereafter records.
+// The key of an element is returned by a GroupFn over its metadata, which is
+// extracted using a MapFn or taken from the Record.
+//
+// At the end of each tick, a summary record is emitted downstream for every key
+// whose records were suppressed.
+//
+//   eg: first = 1, thereafter = 2
+//
+// in  -- a -- a -- a -- b -- a ----|tick
+//        |    |    |    |    |     |
+//    [--------- Sampler ------------]
+//        |         |    |          |
+// out -- a ------- a -- b ---------suppressed(a, 2)
+type Sampler struct {
+	MapF       MapFn
+	KeyF       GroupFn
+	PanicF     PanicHandler
+	in         chan interface{}
+	out        chan interface{}
+	tick       time.Duration
+	first      uint64
+	thereafter uint64
+	maxKeys    int
+	summary    SummaryFunc
+	counts     map[string]*sampleCount
+}
+
+// NewSampler returns a new Sampler instance.
+// mapFunc extracts the metadata of an element, it can be nil if only records
+// are written. keyFunc returns the key by which the elements are sampled.
+// DefaultSamplerTick is used if tick is not positive.
+func NewSampler(mapFunc MapFn, keyFunc GroupFn, tick time.Duration, first, thereafter int, opts ...SamplerOption) *Sampler {
+	s := &Sampler{
+		MapF:       mapFunc,
+		KeyF:       keyFunc,
+		in:         make(chan interface{}),
+		out:        make(chan interface{}),
+		tick:       tick,
+		first:      uint64(first),
+		thereafter: uint64(thereafter),
+		maxKeys:    DefaultSamplerMaxKeys,
+		summary:    DefaultSummary,
+		counts:     make(map[string]*sampleCount),
+	}
+
+	if s.tick <= 0 {
+		s.tick = DefaultSamplerTick
+	}
+
+	for _, o := range opts {
+		o(s)
+	}
+
+	go s.receive()
+
+	return s
+}
+
+// DefaultSummary returns a JSON record such as
+//
+//    {"level":"warn","msg":"suppressed records","key":"ID001","suppressed":42,"tick":"1s"}
+//
+// whose metadata holds the level, msg and key fields.
+func DefaultSummary(key string, suppressed uint64, tick time.Duration) *Record {
+	const msg = "suppressed records"
+
+	return &Record{
+		Metadata: Metadata{"level": "warn", "msg": msg, "key": key},
+		Payload: []byte(fmt.Sprintf(`{"level":"warn","msg":%q,"key":%q,"suppressed":%d,"tick":%q}`+"\n",
+			msg, key, suppressed, tick.String())),
+	}
+}
+
+// Via streams data through the given flow
+func (s *Sampler) Via(flow streams.Flow) streams.Flow {
+	go s.transmit(flow)
+	return flow
+}
+
+// To streams data to the given sink
+func (s *Sampler) To(sink streams.Sink) {
+	s.transmit(sink)
+}
+
+// Out returns an output channel for sending data
+func (s *Sampler) Out() <-chan interface{} {
+	return s.out
+}
+
+// In returns an input channel for receiving data
+func (s *Sampler) In() chan<- interface{} {
+	return s.in
+}
+
+func (s *Sampler) transmit(inlet streams.Inlet) {
+	for elem := range s.Out() {
+		inlet.In() <- elem
+	}
+	close(inlet.In())
+}
+
+func (s *Sampler) receive() {
+	t := time.NewTicker(s.tick)
+	defer t.Stop()
+
+	for {
+		select {
+		case elem, ok := <-s.in:
+			if !ok {
+				s.flush()
+				close(s.out)
+
+				return
+			}
+
+			if s.sample(elem) {
+				s.out <- elem
+			}
+		case <-t.C:
+			s.flush()
+		}
+	}
+}
+
+func (s *Sampler) sample(elem interface{}) (pass bool) {
+	failed := false
+	defer RecoverPanic(s.PanicF, elem, &failed)
+
+	md, _, ok := extract(elem, s.MapF)
+	if !ok {
+		return true
+	}
+
+	k := s.KeyF(md)
+	c, ok := s.counts[k]
+	if !ok {
+		if len(s.counts) >= s.maxKeys {
+			k = SamplerOverflowKey
+		}
+		if c, ok = s.counts[k]; !ok {
+			c = &sampleCount{}
+			s.counts[k] = c
+		}
+	}
+
+	c.n++
+	if c.n <= s.first || (s.thereafter > 0 && (c.n-s.first)%s.thereafter == 0) {
+		return true
+	}
+	c.suppressed++
+
+	return false
+}
+
+// flush emits the summaries and starts a new tick.
+func (s *Sampler) flush() {
+	for k, c := range s.counts {
+		if c.suppressed > 0 {
+			s.out <- s.summary(k, c.suppressed, s.tick)
+		}
+	}
+	s.counts = make(map[string]*sampleCount)
+}
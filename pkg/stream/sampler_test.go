@@ -0,0 +1,47 @@
+package stream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSampler(t *testing.T) {
+	var _input []string
+	for i := 0; i < 10; i++ {
+		_input = append(_input, "a")
+	}
+	_input = append(_input, "b", "c", "d", "e", "f")
+
+	sampler := NewSampler(
+		func(i []byte) (Metadata, []byte) {
+			return Metadata{"key": string(i)}, i
+		},
+		func(md Metadata) string {
+			return md["key"]
+		},
+		time.Hour, 2, 3,
+		WithMaxKeys(2),
+	)
+
+	// a: 1, 2, 5 and 8 are passed, b has its own key, c to f share the overflow key
+	want := []string{
+		"a", "a", "a", "a", "b", "c", "d",
+		summaryString("a", 6),
+		summaryString(SamplerOverflowKey, 2),
+	}
+
+	assert.ElementsMatch(t, want, runFlow(sampler, _input))
+}
+
+func summaryString(key string, suppressed uint64) string {
+	return string(DefaultSummary(key, suppressed, time.Hour).Payload)
+}
+
+func TestSamplerDefaultTick(t *testing.T) {
+	// a tick of 0 falls back to DefaultSamplerTick instead of panicking
+	sampler := NewSampler(nil, func(md Metadata) string { return "" }, 0, 1, 0)
+
+	assert.Equal(t, []string{"a"}, runFlow(sampler, []string{"a"}))
+}
@@ -0,0 +1,114 @@
+package stream
+
+import (
+	"github.com/reugn/go-streams"
+)
+
+const (
+	DefaultTeeBufferSize = 1000
+)
+
+// Tee duplicates the incoming elements to a number of inlets, while passing
+// them downstream as well.
+//
+// in  -- 1 -- 2 -- 3 ------------------
+//        |    |    |
+//    [---------- Tee ----------] -- 1 -- 2 -- 3 --> inlets
+//        |    |    |
+// out -- 1 -- 2 -- 3 ------------------
+//
+// Each inlet is fed by its own goroutine through its own buffer, so a slow
+// inlet doesn't stall the others nor the output until its buffer is full.
+// Byte slices and records are copied before being handed to the inlets as the
+// downstream writer may reuse them.
+type Tee struct {
+	in      chan interface{}
+	out     chan interface{}
+	buffers []chan interface{}
+}
+
+// NewTee returns a new Tee instance buffering DefaultTeeBufferSize elements
+// per inlet. The inlets are closed once the Tee input is closed and their
+// buffer is drained.
+func NewTee(inlets ...streams.Inlet) *Tee {
+	return NewBufferedTee(DefaultTeeBufferSize, inlets...)
+}
+
+// NewBufferedTee returns a new Tee instance buffering size elements per inlet.
+func NewBufferedTee(size int, inlets ...streams.Inlet) *Tee {
+	t := &Tee{
+		in:  make(chan interface{}),
+		out: make(chan interface{}),
+	}
+
+	for _, inlet := range inlets {
+		buf := make(chan interface{}, size)
+		t.buffers = append(t.buffers, buf)
+
+		go feed(buf, inlet)
+	}
+
+	go t.receive()
+
+	return t
+}
+
+// Via streams data through the given flow
+func (t *Tee) Via(flow streams.Flow) streams.Flow {
+	go t.transmit(flow)
+	return flow
+}
+
+// To streams data to the given sink
+func (t *Tee) To(sink streams.Sink) {
+	t.transmit(sink)
+}
+
+// Out returns an output channel for sending data
+func (t *Tee) Out() <-chan interface{} {
+	return t.out
+}
+
+// In returns an input channel for receiving data
+func (t *Tee) In() chan<- interface{} {
+	return t.in
+}
+
+func (t *Tee) transmit(inlet streams.Inlet) {
+	for elem := range t.Out() {
+		inlet.In() <- elem
+	}
+	close(inlet.In())
+}
+
+func (t *Tee) receive() {
+	for elem := range t.in {
+		for _, buf := range t.buffers {
+			buf <- duplicate(elem)
+		}
+		t.out <- elem
+	}
+
+	for _, buf := range t.buffers {
+		close(buf)
+	}
+	close(t.out)
+}
+
+func feed(buf chan interface{}, inlet streams.Inlet) {
+	for elem := range buf {
+		inlet.In() <- elem
+	}
+	close(inlet.In())
+}
+
+func duplicate(elem interface{}) interface{} {
+	switch x := elem.(type) {
+	case []byte:
+		return append([]byte(nil), x...)
+	case *Record:
+		return &Record{Metadata: x.Metadata, Payload: append([]byte(nil), x.Payload...)}
+	default:
+		return elem
+	}
+}
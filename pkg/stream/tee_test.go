@@ -0,0 +1,40 @@
+package stream
+
+import (
+	ext "github.com/reugn/go-streams/extension"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTee(t *testing.T) {
+	in := make(chan interface{})
+	out := make(chan interface{})
+	// the tee output is only consumed once the flow is done
+	teeOut := make(chan interface{})
+
+	source := ext.NewChanSource(in)
+	flow := NewTee(ext.NewChanSink(teeOut))
+	sink := ext.NewChanSink(out)
+
+	var _input = []int{1, 2, 3, 4, 5}
+
+	go ingest(_input, in)
+	go func() {
+		source.
+			Via(flow).
+			To(sink)
+	}()
+
+	var _output []int
+	for e := range sink.Out {
+		_output = append(_output, e.(int))
+	}
+
+	var _teeOutput []int
+	for e := range teeOut {
+		_teeOutput = append(_teeOutput, e.(int))
+	}
+
+	assert.Equal(t, _input, _output)
+	assert.Equal(t, _input, _teeOutput)
+}
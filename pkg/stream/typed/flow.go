@@ -0,0 +1,153 @@
+//go:build go1.21
+// +build go1.21
+
+// Package typed is a type-safe layer over the flows of go-streams and
+// pkg/stream. The flows are still plain streams.Flow, so they can be given to
+// nbw.NewStreamWriter or stream.NewPipe, but they can only be chained with
+// Via when the output of a flow matches the input of the next one.
+//
+// The first flow of a stream writer receives byte slices, or *stream.Record
+// for the records written with WriteRecord. An element which isn't of the
+// input type of a flow is handed to its PanicHandler and dropped, as are the
+// elements whose processing panicked.
+package typed
+
+import (
+	"fmt"
+
+	"github.com/reugn/go-streams"
+	"github.com/reugn/go-streams/flow"
+
+	bbx "github.com/BinaryHexer/nbw/pkg/bundler"
+	"github.com/BinaryHexer/nbw/pkg/stream"
+)
+
+// Option can be used to setup the typed flows.
+type Option func(*options)
+
+type options struct {
+	panicHandler stream.PanicHandler
+}
+
+// WithPanicHandler sets the handler called with the elements whose processing
+// panicked or which aren't of the input type of the flow. The default is to
+// log the panic.
+func WithPanicHandler(h stream.PanicHandler) Option {
+	return Option(func(o *options) {
+		o.panicHandler = h
+	})
+}
+
+// Flow is a streams.Flow receiving elements of type In and emitting elements
+// of type Out.
+type Flow[In, Out any] struct {
+	streams.Flow
+}
+
+// Via chains f1 and f2 into a single flow.
+func Via[A, B, C any](f1 Flow[A, B], f2 Flow[B, C]) Flow[A, C] {
+	return Flow[A, C]{stream.NewPipe(f1, f2)}
+}
+
+// Map returns a flow transforming each element with fn, using parallelism goroutines.
+func Map[In, Out any](fn func(In) Out, parallelism uint, opts ...Option) Flow[In, Out] {
+	h := handler(opts)
+
+	return Flow[In, Out]{flow.NewFlatMap(func(i interface{}) []interface{} {
+		var out interface{}
+		if !apply(h, i, func(x In) { out = fn(x) }) {
+			return nil
+		}
+
+		return []interface{}{out}
+	}, parallelism)}
+}
+
+// FlatMap returns a flow transforming each element into zero or more elements
+// with fn, using parallelism goroutines.
+func FlatMap[In, Out any](fn func(In) []Out, parallelism uint, opts ...Option) Flow[In, Out] {
+	h := handler(opts)
+
+	return Flow[In, Out]{flow.NewFlatMap(func(i interface{}) []interface{} {
+		var xs []Out
+		if !apply(h, i, func(x In) { xs = fn(x) }) {
+			return nil
+		}
+
+		is := make([]interface{}, len(xs))
+		for idx, x := range xs {
+			is[idx] = x
+		}
+
+		return is
+	}, parallelism)}
+}
+
+// Filter returns a flow dropping the elements rejected by fn, using parallelism goroutines.
+func Filter[T any](fn func(T) bool, parallelism uint, opts ...Option) Flow[T, T] {
+	h := handler(opts)
+
+	return Flow[T, T]{flow.NewFilter(func(i interface{}) bool {
+		var keep bool
+		return apply(h, i, func(x T) { keep = fn(x) }) && keep
+	}, parallelism)}
+}
+
+// Aggregate returns a flow grouping the elements by the key returned by fn,
+// see stream.Aggregator. Keys are compared by their type and fmt %#v
+// representation, so that distinct keys of the same type don't share a group.
+// An element which isn't of type T is logged and dropped.
+func Aggregate[K comparable, T any](fn func(T) K, opts ...bbx.Option) Flow[T, []T] {
+	a := stream.NewAggregator(func(i interface{}) string {
+		x, ok := i.(T)
+		if !ok {
+			panic(mismatch[T](i))
+		}
+		k := fn(x)
+
+		return fmt.Sprintf("%T:%#v", k, k)
+	}, opts...)
+
+	m := flow.NewMap(func(i interface{}) interface{} {
+		xs := i.([]interface{})
+		ts := make([]T, len(xs))
+		for idx, x := range xs {
+			ts[idx] = x.(T)
+		}
+
+		return ts
+	}, 1)
+
+	return Flow[T, []T]{stream.NewPipe(a, m)}
+}
+
+func handler(opts []Option) stream.PanicHandler {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o.panicHandler
+}
+
+// apply calls fn with i, and reports whether i was of type In and fn returned
+// without panicking.
+func apply[In any](h stream.PanicHandler, i interface{}, fn func(In)) (ok bool) {
+	var failed bool
+	defer func() {
+		ok = !failed
+	}()
+	defer stream.RecoverPanic(h, i, &failed)
+
+	x, match := i.(In)
+	if !match {
+		panic(mismatch[In](i))
+	}
+	fn(x)
+
+	return true
+}
+
+func mismatch[T any](i interface{}) error {
+	return fmt.Errorf("typed: got an element of type %T, want %T", i, *new(T))
+}
@@ -0,0 +1,130 @@
+//go:build go1.21
+// +build go1.21
+
+package typed
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/BinaryHexer/nbw"
+)
+
+type entry struct {
+	UUID  string `json:"uuid"`
+	Level string `json:"level"`
+	raw   []byte
+}
+
+func TestFlow(t *testing.T) {
+	msgs := []string{
+		`{"uuid":"ID001","level":"debug"}`,
+		`{"uuid":"ID001","level":"info"}`,
+		`{"uuid":"ID002","level":"info"}`,
+		`{"uuid":"ID001","level":"error"}`,
+	}
+
+	// same pipeline as stream.NewBasicFlow, keeping the groups with an error
+	parse := Map(func(p []byte) entry {
+		e := entry{raw: p}
+		_ = json.Unmarshal(p, &e)
+
+		return e
+	}, 2)
+	noDebug := Filter(func(e entry) bool {
+		return e.Level != "debug"
+	}, 2)
+	byUUID := Aggregate(func(e entry) string {
+		return e.UUID
+	})
+	withError := Filter(func(es []entry) bool {
+		for _, e := range es {
+			if e.Level == "error" {
+				return true
+			}
+		}
+
+		return false
+	}, 2)
+	flatten := FlatMap(func(es []entry) [][]byte {
+		ps := make([][]byte, len(es))
+		for idx, e := range es {
+			ps[idx] = e.raw
+		}
+
+		return ps
+	}, 2)
+
+	f := Via(Via(Via(Via(parse, noDebug), byUUID), withError), flatten)
+
+	buf := &bytes.Buffer{}
+	w := nbw.NewStreamWriter(buf, f)
+
+	for _, msg := range msgs {
+		_, err := w.Write([]byte(msg + "\n"))
+		assert.NoError(t, err)
+	}
+
+	err := w.Close()
+	assert.NoError(t, err)
+
+	got := strings.Split(buf.String(), "\n")
+	assert.ElementsMatch(t, []string{msgs[1], msgs[3], ""}, got)
+}
+
+func TestFlowTypeMismatch(t *testing.T) {
+	var mismatches int
+	h := func(elem interface{}, v interface{}) {
+		mismatches++
+	}
+
+	// the stream writer feeds byte slices, not strings
+	upper := Map(strings.ToUpper, 1, WithPanicHandler(h))
+
+	buf := &bytes.Buffer{}
+	w := nbw.NewStreamWriter(buf, upper)
+
+	_, err := w.Write([]byte("Hello, World!\n"))
+	assert.NoError(t, err)
+
+	err = w.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "", buf.String())
+	assert.Equal(t, 1, mismatches)
+}
+
+func TestAggregateKeys(t *testing.T) {
+	type key struct {
+		a, b string
+	}
+
+	// both keys print as "{a b }" with fmt.Sprint
+	msgs := map[string]key{
+		"first\n":  {a: "a b", b: ""},
+		"second\n": {a: "a", b: "b "},
+	}
+
+	byKey := Aggregate(func(p []byte) key {
+		return msgs[string(p)]
+	})
+	count := Map(func(ps [][]byte) []byte {
+		return []byte(fmt.Sprintf("%d\n", len(ps)))
+	}, 1)
+
+	buf := &bytes.Buffer{}
+	w := nbw.NewStreamWriter(buf, Via(byKey, count))
+
+	for msg := range msgs {
+		_, err := w.Write([]byte(msg))
+		assert.NoError(t, err)
+	}
+
+	err := w.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "1\n1\n", buf.String())
+}
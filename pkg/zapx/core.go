@@ -0,0 +1,191 @@
+package zapx
+
+import (
+	"fmt"
+	"io"
+
+	"go.uber.org/zap/zapcore"
+
+	iox "github.com/BinaryHexer/nbw/pkg/io"
+	"github.com/BinaryHexer/nbw/pkg/stream"
+)
+
+const (
+	DefaultSamplingThreshold = 0.8
+
+	LevelKey   = "level"
+	MessageKey = "msg"
+)
+
+// Option can be used to setup the core.
+type Option func(*core)
+
+// WithDirect sets a synchronous writer used for the entries enabled by lvl,
+// e.g. zapcore.ErrorLevel, instead of the nbw writer. Such entries are synced
+// right away so they are durable when Write returns. Since they bypass the
+// queue, they can be written before entries logged earlier.
+func WithDirect(lvl zapcore.LevelEnabler, ws zapcore.WriteSyncer) Option {
+	return Option(func(c *core) {
+		c.directLevel = lvl
+		c.direct = ws
+	})
+}
+
+// WithSampling drops the entries below lvl while the nbw writer reports a
+// backpressure at or above threshold, so that low severity logs don't crowd out
+// the others under load. It is a no-op for writers not implementing
+// iox.Backpressurer. By default no entries are dropped.
+func WithSampling(lvl zapcore.Level, threshold float64) Option {
+	return Option(func(c *core) {
+		c.sampleLevel = lvl
+		c.threshold = threshold
+	})
+}
+
+type core struct {
+	zapcore.LevelEnabler
+	enc     zapcore.Encoder
+	out     zapcore.WriteSyncer
+	records stream.RecordWriter
+	fields  []zapcore.Field
+
+	direct      zapcore.WriteSyncer
+	directLevel zapcore.LevelEnabler
+
+	pressure    iox.Backpressurer
+	sampleLevel zapcore.Level
+	threshold   float64
+}
+
+// NewCore creates a zapcore.Core writing the entries to w, typically one of
+// the nbw writers.
+//
+// Contrary to wrapping the writer with zapcore.AddSync, Sync drains the
+// writer when it supports it (see AddSync). The level, message and fields of
+// each entry are also handed as stream.Metadata to writers implementing
+// stream.RecordWriter, such as the stream writer, so that the flows built by
+// stream.NewBasicFlow don't need to parse the encoded entry again.
+//
+//     wr := nbw.NewDiodeWriter(os.Stdout, 1000, 0, nil)
+//     core := zapx.NewCore(enc, wr, zapcore.DebugLevel,
+//         zapx.WithDirect(zapcore.ErrorLevel, zapcore.Lock(os.Stderr)),
+//         zapx.WithSampling(zapcore.InfoLevel, zapx.DefaultSamplingThreshold),
+//     )
+//     logger := zap.New(core)
+func NewCore(enc zapcore.Encoder, w io.Writer, lvl zapcore.LevelEnabler, opts ...Option) zapcore.Core {
+	c := &core{
+		LevelEnabler: lvl,
+		enc:          enc,
+		out:          AddSync(w),
+		sampleLevel:  zapcore.DebugLevel,
+		threshold:    DefaultSamplingThreshold,
+	}
+
+	if p, ok := w.(iox.Backpressurer); ok {
+		c.pressure = p
+	}
+
+	if rw, ok := w.(stream.RecordWriter); ok {
+		c.records = rw
+	}
+
+	for _, o := range opts {
+		o(c)
+	}
+
+	return c
+}
+
+func (c *core) With(fields []zapcore.Field) zapcore.Core {
+	clone := c.clone()
+	for i := range fields {
+		fields[i].AddTo(clone.enc)
+	}
+
+	if c.records != nil {
+		clone.fields = append(clone.fields[:len(clone.fields):len(clone.fields)], fields...)
+	}
+
+	return clone
+}
+
+func (c *core) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.Enabled(ent.Level) || c.shed(ent.Level) {
+		return ce
+	}
+
+	return ce.AddCore(ent, c)
+}
+
+func (c *core) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	defer buf.Free()
+
+	if c.direct != nil && c.directLevel.Enabled(ent.Level) {
+		if _, err := c.direct.Write(buf.Bytes()); err != nil {
+			return err
+		}
+
+		return c.direct.Sync()
+	}
+
+	if c.records != nil {
+		_, err = c.records.WriteRecord(c.metadata(ent, fields), buf.Bytes())
+	} else {
+		_, err = c.out.Write(buf.Bytes())
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if ent.Level > zapcore.ErrorLevel {
+		// since we may be crashing the program, sync the output
+		return c.Sync()
+	}
+
+	return nil
+}
+
+func (c *core) Sync() error {
+	if c.direct != nil {
+		if err := c.direct.Sync(); err != nil {
+			return err
+		}
+	}
+
+	return c.out.Sync()
+}
+
+func (c *core) metadata(ent zapcore.Entry, fields []zapcore.Field) stream.Metadata {
+	enc := zapcore.NewMapObjectEncoder()
+	for i := range c.fields {
+		c.fields[i].AddTo(enc)
+	}
+	for i := range fields {
+		fields[i].AddTo(enc)
+	}
+
+	md := make(stream.Metadata, len(enc.Fields)+2)
+	for k, v := range enc.Fields {
+		md[k] = fmt.Sprint(v)
+	}
+	md[LevelKey] = ent.Level.String()
+	md[MessageKey] = ent.Message
+
+	return md
+}
+
+func (c *core) shed(lvl zapcore.Level) bool {
+	return c.pressure != nil && lvl < c.sampleLevel && c.pressure.Backpressure() >= c.threshold
+}
+
+func (c *core) clone() *core {
+	clone := *c
+	clone.enc = c.enc.Clone()
+
+	return &clone
+}
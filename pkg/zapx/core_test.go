@@ -0,0 +1,65 @@
+package zapx
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/BinaryHexer/nbw"
+	"github.com/BinaryHexer/nbw/internal/io/bundler"
+)
+
+func TestCore(t *testing.T) {
+	buf := &bytes.Buffer{}
+	direct := &bytes.Buffer{}
+	w := nbw.NewBundlerWriter(buf, bundler.WithDelayThreshold(time.Hour))
+
+	logger := zap.New(NewCore(
+		zapcore.NewJSONEncoder(zapcore.EncoderConfig{MessageKey: "msg", LevelKey: "level", EncodeLevel: zapcore.LowercaseLevelEncoder}),
+		w,
+		zapcore.DebugLevel,
+		WithDirect(zapcore.ErrorLevel, zapcore.AddSync(direct)),
+	))
+
+	logger.Info("hello")
+	logger.Error("failed")
+
+	// the error bypasses the bundler, the info waits for the delay threshold
+	assert.Equal(t, "", buf.String())
+	assert.Equal(t, `{"level":"error","msg":"failed"}`+"\n", direct.String())
+
+	err := logger.Sync()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"level":"info","msg":"hello"}`+"\n", buf.String())
+}
+
+func TestCoreSampling(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := nbw.NewBundlerWriter(buf, bundler.WithDelayThreshold(time.Hour), bundler.WithBufferedByteLimit(400))
+
+	logger := zap.New(NewCore(
+		zapcore.NewJSONEncoder(zapcore.EncoderConfig{MessageKey: "msg"}),
+		w,
+		zapcore.DebugLevel,
+		WithSampling(zapcore.InfoLevel, 0.5),
+	))
+
+	for i := 0; i < 10; i++ {
+		logger.Debug("debug")
+		logger.Info("info")
+	}
+
+	err := logger.Sync()
+	assert.NoError(t, err)
+
+	// debug entries are dropped once half of the buffer is used
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, 10, strings.Count(buf.String(), "info"))
+	assert.Less(t, strings.Count(buf.String(), "debug"), 10)
+	assert.Greater(t, len(lines), 10)
+}
@@ -0,0 +1,30 @@
+package zapx
+
+import (
+	"io"
+
+	"go.uber.org/zap/zapcore"
+
+	iox "github.com/BinaryHexer/nbw/pkg/io"
+)
+
+// AddSync converts a nbw writer to a zapcore.WriteSyncer.
+//
+// Contrary to zapcore.AddSync, Sync is forwarded to writers implementing
+// iox.WriteSyncer, which drain their buffers before returning, e.g. the
+// diode and bundler writers. For the other writers Sync is a no-op.
+func AddSync(w io.Writer) zapcore.WriteSyncer {
+	if ws, ok := w.(iox.WriteSyncer); ok {
+		return ws
+	}
+
+	return writerWrapper{w}
+}
+
+type writerWrapper struct {
+	io.Writer
+}
+
+func (w writerWrapper) Sync() error {
+	return nil
+}
@@ -0,0 +1,65 @@
+package zerologx
+
+import (
+	"io"
+
+	"github.com/rs/zerolog"
+
+	iox "github.com/BinaryHexer/nbw/pkg/io"
+	"github.com/BinaryHexer/nbw/pkg/stream"
+)
+
+const (
+	LevelKey = "level"
+)
+
+// LevelWriter is a zerolog.LevelWriter writing the events to a nbw writer.
+//
+// The level of each event is handed as stream.Metadata to writers implementing
+// stream.RecordWriter, such as the stream writer, so that the flows built by
+// stream.NewBasicFlow can filter and group on it without parsing the event.
+type LevelWriter struct {
+	w io.Writer
+}
+
+// NewLevelWriter creates a LevelWriter wrapping w, typically one of the nbw writers.
+//
+//     wr := zerologx.NewLevelWriter(nbw.NewDiodeWriter(os.Stdout, 1000, 0, nil))
+//     defer wr.Close()
+//     logger := zerolog.New(wr)
+//     logger.Info().Msg("hello world")
+func NewLevelWriter(w io.Writer) *LevelWriter {
+	return &LevelWriter{w: w}
+}
+
+func (lw *LevelWriter) Write(p []byte) (int, error) {
+	return lw.w.Write(p)
+}
+
+func (lw *LevelWriter) WriteLevel(l zerolog.Level, p []byte) (int, error) {
+	if rw, ok := lw.w.(stream.RecordWriter); ok {
+		return rw.WriteRecord(stream.Metadata{LevelKey: l.String()}, p)
+	}
+
+	return lw.w.Write(p)
+}
+
+// Sync call Sync on the wrapped writer if iox.WriteSyncer is implemented,
+// which writes the events still buffered.
+func (lw *LevelWriter) Sync() error {
+	if w, ok := lw.w.(iox.WriteSyncer); ok {
+		return w.Sync()
+	}
+
+	return nil
+}
+
+// Close call Close on the wrapped writer if io.Closer is implemented,
+// which writes the events still buffered.
+func (lw *LevelWriter) Close() error {
+	if w, ok := lw.w.(io.Closer); ok {
+		return w.Close()
+	}
+
+	return nil
+}
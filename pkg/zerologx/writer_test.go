@@ -0,0 +1,72 @@
+package zerologx
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/BinaryHexer/nbw"
+	"github.com/BinaryHexer/nbw/pkg/stream"
+)
+
+const records = 1000
+
+func TestLevelWriter(t *testing.T) {
+	tests := []struct {
+		w func(w io.Writer) io.WriteCloser
+	}{
+		{w: func(w io.Writer) io.WriteCloser { return nbw.NewBundlerWriter(w) }},
+		{w: func(w io.Writer) io.WriteCloser { return nbw.NewDiodeWriter(w, 10*records, 0, nil) }},
+		{w: func(w io.Writer) io.WriteCloser { return nbw.NewStreamWriter(w) }},
+	}
+
+	for idx, tt := range tests {
+		tt := tt
+
+		t.Run(fmt.Sprintf("%d", idx), func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			w := NewLevelWriter(tt.w(buf))
+			logger := zerolog.New(w)
+
+			for i := 0; i < records; i++ {
+				logger.Info().Int("iter", i).Msg("hello world")
+			}
+
+			err := w.Close()
+			assert.NoError(t, err)
+			assert.Equal(t, records, strings.Count(buf.String(), "\n"))
+		})
+	}
+}
+
+func TestLevelWriterMetadata(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewLevelWriter(nbw.NewStreamWriter(buf, stream.NewBasicFlow(
+		func(i []byte) (stream.Metadata, []byte) {
+			t.Error("events should not be parsed again")
+			return stream.Metadata{}, i
+		},
+		func(md stream.Metadata) bool {
+			return md[LevelKey] != "debug"
+		},
+		func(md stream.Metadata) string {
+			return ""
+		},
+		func(mds []stream.Metadata) bool {
+			return true
+		},
+	)))
+	logger := zerolog.New(w)
+
+	logger.Debug().Msg("dropped")
+	logger.Info().Msg("hello world")
+
+	err := w.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"level":"info","message":"hello world"}`+"\n", buf.String())
+}
@@ -8,17 +8,67 @@ import (
 
 	"github.com/BinaryHexer/nbw/internal/io/bundler"
 	"github.com/BinaryHexer/nbw/internal/io/diode"
+	"github.com/BinaryHexer/nbw/internal/io/failover"
+	"github.com/BinaryHexer/nbw/internal/io/frame"
+	"github.com/BinaryHexer/nbw/internal/io/multi"
+	"github.com/BinaryHexer/nbw/internal/io/priority"
+	"github.com/BinaryHexer/nbw/internal/io/redact"
+	"github.com/BinaryHexer/nbw/internal/io/retry"
+	"github.com/BinaryHexer/nbw/internal/io/shed"
+	"github.com/BinaryHexer/nbw/internal/io/spill"
 	"github.com/BinaryHexer/nbw/internal/io/stream"
+	rtx "github.com/BinaryHexer/nbw/pkg/retry"
+	stx "github.com/BinaryHexer/nbw/pkg/stream"
 )
 
-func NewDiodeWriter(w io.Writer, size int, poolInterval time.Duration, f diode.Alerter) *diode.Writer {
-	return diode.NewWriter(w, size, poolInterval, f)
+func NewDiodeWriter(w io.Writer, size int, poolInterval time.Duration, f diode.Alerter, opts ...diode.WriterOption) *diode.Writer {
+	return diode.NewWriter(w, size, poolInterval, f, opts)
 }
 
 func NewBundlerWriter(w io.Writer, opts ...bundler.WriterOption) *bundler.Writer {
 	return bundler.NewWriter(w, opts)
 }
 
+func NewWALBundlerWriter(w io.Writer, dir string, opts ...bundler.WriterOption) (*bundler.Writer, error) {
+	return bundler.NewWALWriter(w, dir, opts)
+}
+
 func NewStreamWriter(w io.Writer, flows ...streams.Flow) *stream.Writer {
-	return stream.NewWriter(w, flows)
+	return stream.NewWriter(w, flows, nil)
+}
+
+func NewStreamWriterWithOptions(w io.Writer, opts []stream.WriterOption, flows ...streams.Flow) *stream.Writer {
+	return stream.NewWriter(w, flows, opts)
+}
+
+func NewMultiWriter(wrap func(io.Writer) io.WriteCloser, sinks ...io.Writer) *multi.Writer {
+	return multi.NewWriter(wrap, sinks)
+}
+
+func NewFailoverWriter(primary, secondary io.Writer, opts ...failover.WriterOption) *failover.Writer {
+	return failover.NewWriter(primary, secondary, opts)
+}
+
+func NewRetryWriter(w io.Writer, p rtx.Policy, deadLetter io.Writer) *retry.Writer {
+	return retry.NewWriter(w, p, deadLetter)
+}
+
+func NewSpillWriter(w io.Writer, dir string, opts ...spill.WriterOption) (*spill.Writer, error) {
+	return spill.NewWriter(w, dir, opts)
+}
+
+func NewShedWriter(w io.Writer, opts ...shed.WriterOption) *shed.Writer {
+	return shed.NewWriter(w, opts)
+}
+
+func NewRedactWriter(w io.Writer, opts ...stx.RedactOption) *redact.Writer {
+	return redact.NewWriter(w, stx.NewScrubber(opts...))
+}
+
+func NewFrameWriter(w io.Writer, opts ...frame.WriterOption) *frame.Writer {
+	return frame.NewWriter(w, opts)
+}
+
+func NewPriorityWriter(w io.Writer, opts ...priority.WriterOption) *priority.Writer {
+	return priority.NewWriter(w, opts)
 }
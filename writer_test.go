@@ -7,12 +7,26 @@ import (
 	"testing"
 
 	"github.com/reugn/go-streams"
+	"github.com/reugn/go-streams/flow"
 	"github.com/stretchr/testify/assert"
 
 	"fmt"
+	"errors"
+	"github.com/BinaryHexer/nbw/internal/io/bundler"
+	"github.com/BinaryHexer/nbw/internal/io/diode"
+	"github.com/BinaryHexer/nbw/internal/io/failover"
+	"github.com/BinaryHexer/nbw/internal/io/frame"
+	"github.com/BinaryHexer/nbw/internal/io/priority"
+	"github.com/BinaryHexer/nbw/internal/io/shed"
+	"github.com/BinaryHexer/nbw/internal/io/spill"
+	iostream "github.com/BinaryHexer/nbw/internal/io/stream"
+	"github.com/BinaryHexer/nbw/pkg/compress"
+	rtx "github.com/BinaryHexer/nbw/pkg/retry"
 	"github.com/BinaryHexer/nbw/pkg/stream"
 	"io"
 	"sync"
+	"sync/atomic"
+	"testing/iotest"
 	"time"
 )
 
@@ -39,6 +53,132 @@ func TestBundlerWriter(t *testing.T) {
 	}
 }
 
+func TestBundlerWriterCompression(t *testing.T) {
+	msgs := []string{"Hello, World!\n", "Hello, World!\n", "Goodbye!\n"}
+
+	for _, c := range []compress.Codec{compress.Gzip, compress.Zstd, compress.Snappy} {
+		buf := &bytes.Buffer{}
+		w := NewBundlerWriter(buf, bundler.WithCompression(c))
+
+		for _, msg := range msgs {
+			_, err := w.Write([]byte(msg))
+			assert.NoError(t, err)
+		}
+
+		err := w.Close()
+		assert.NoError(t, err)
+
+		var got string
+		r := compress.NewReader(buf)
+		for {
+			p, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			assert.NoError(t, err, c.String())
+			got += string(p)
+		}
+		assert.Equal(t, strings.Join(msgs, ""), got, c.String())
+	}
+}
+
+func TestWALBundlerWriter(t *testing.T) {
+	dir := t.TempDir()
+	msgs := []string{"1\n", "2\n", "3\n", "4\n"}
+
+	// the first process fails to deliver anything
+	buf := &flakyWriter{failures: len(msgs)}
+	w, err := NewWALBundlerWriter(buf, dir, bundler.WithFsyncPolicy(bundler.FsyncEveryRecord))
+	assert.NoError(t, err)
+
+	for _, msg := range msgs {
+		_, err = w.Write([]byte(msg))
+		assert.NoError(t, err)
+	}
+	err = w.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "", buf.String())
+
+	// the next process replays the records which were not acknowledged
+	buf = &flakyWriter{}
+	w, err = NewWALBundlerWriter(buf, dir, bundler.WithFsyncPolicy(bundler.FsyncEveryBundle))
+	assert.NoError(t, err)
+	assert.Equal(t, "1\n2\n3\n4\n", buf.String())
+
+	_, err = w.Write([]byte("5\n"))
+	assert.NoError(t, err)
+	err = w.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "1\n2\n3\n4\n5\n", buf.String())
+
+	// everything was acknowledged
+	buf = &flakyWriter{}
+	w, err = NewWALBundlerWriter(buf, dir)
+	assert.NoError(t, err)
+	err = w.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "", buf.String())
+}
+
+func TestBundlerWriterErrors(t *testing.T) {
+	var errs int64
+	buf := &flakyWriter{failures: 100}
+	w := NewBundlerWriter(buf,
+		bundler.WithBundleCountThreshold(1),
+		bundler.WithOnError(func(err error) {
+			atomic.AddInt64(&errs, 1)
+		}),
+	)
+
+	// more failures than the error channel holds must not block the writer
+	for i := 0; i < 50; i++ {
+		_, err := w.Write([]byte("Hello, World!"))
+		assert.NoError(t, err)
+	}
+
+	err := w.Sync()
+	assert.NoError(t, err)
+	err = w.Close()
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, atomic.LoadInt64(&errs), int64(bundler.DefaultErrChanCapacity))
+
+	// closing twice is a no-op
+	err = w.Close()
+	assert.NoError(t, err)
+}
+
+func TestWALBundlerWriterRetry(t *testing.T) {
+	dir := t.TempDir()
+
+	// the first bundle fails once, then the log is delivered from its head
+	buf := &flakyWriter{failures: 1}
+	w, err := NewWALBundlerWriter(buf, dir, bundler.WithOnError(func(error) {}))
+	assert.NoError(t, err)
+
+	for _, msg := range []string{"1\n", "2\n"} {
+		_, err = w.Write([]byte(msg))
+		assert.NoError(t, err)
+	}
+	err = w.Sync()
+	assert.NoError(t, err)
+	assert.Equal(t, "1\n2\n", buf.String())
+
+	// the writer is back to bundling
+	_, err = w.Write([]byte("3\n"))
+	assert.NoError(t, err)
+	err = w.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "1\n2\n3\n", buf.String())
+
+	// nothing is delivered twice
+	buf = &flakyWriter{}
+	w, err = NewWALBundlerWriter(buf, dir)
+	assert.NoError(t, err)
+	err = w.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "", buf.String())
+}
+
 func TestDiodeWriter(t *testing.T) {
 	tests := []struct {
 		msg string
@@ -62,6 +202,80 @@ func TestDiodeWriter(t *testing.T) {
 	}
 }
 
+func TestDiodeWriterOverflow(t *testing.T) {
+	buf := &gateWriter{started: make(chan struct{}), release: make(chan struct{})}
+	overflow := &syncBuffer{}
+	w := NewDiodeWriter(buf, 4, 0, nil, diode.WithOverflowWriter(overflow))
+
+	// the sink blocks on the first record, the diode holds 4 records in total
+	_, _ = w.Write([]byte("0\n"))
+	<-buf.started
+	for i := 1; i <= 6; i++ {
+		_, err := w.Write([]byte(fmt.Sprintf("%d\n", i)))
+		assert.NoError(t, err)
+	}
+
+	close(buf.release)
+	err := w.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "0\n1\n2\n3\n", buf.String())
+	assert.Equal(t, "4\n5\n6\n", overflow.String())
+}
+
+func TestDiodeWriterShards(t *testing.T) {
+	buf := &gateWriter{started: make(chan struct{}), release: make(chan struct{})}
+	key := func(p []byte) string {
+		return strings.SplitN(string(p), ":", 2)[0]
+	}
+	w := NewDiodeWriter(buf, 4, time.Millisecond, nil, diode.WithShards(2, key))
+
+	// the sink blocks on the first record while the noisy producer floods its ring
+	_, _ = w.Write([]byte("noisy:0\n"))
+	<-buf.started
+	for i := 1; i <= 20; i++ {
+		_, _ = w.Write([]byte(fmt.Sprintf("noisy:%d\n", i)))
+	}
+	_, _ = w.Write([]byte("audit:0\n"))
+	assert.Equal(t, float64(1), w.Backpressure())
+
+	close(buf.release)
+	err := w.Sync()
+	assert.NoError(t, err)
+	err = w.Close()
+	assert.NoError(t, err)
+
+	// the audit producer hashes to its own ring and is never evicted
+	assert.Contains(t, buf.String(), "audit:0\n")
+	assert.Contains(t, buf.String(), "noisy:20\n")
+
+	var dropped uint64
+	perKey := make(map[string]diode.KeyStats)
+	for _, s := range w.Stats() {
+		if s.Dropped > 0 {
+			assert.Equal(t, []string{"noisy"}, s.Keys)
+		}
+		dropped += s.Dropped
+		for k, ks := range s.PerKey {
+			perKey[k] = ks
+		}
+	}
+	assert.Equal(t, uint64(16), dropped)
+	assert.Equal(t, map[string]diode.KeyStats{
+		"noisy": {Written: 21, Dropped: 16, Evicted: 16},
+		"audit": {Written: 1, Dropped: 0, Evicted: 0},
+	}, perKey)
+
+	// without key function, a single ring is used
+	single := &bytes.Buffer{}
+	w = NewDiodeWriter(single, 4, time.Millisecond, nil, diode.WithShards(2, nil))
+	_, err = w.Write([]byte("Hello, World!"))
+	assert.NoError(t, err)
+	err = w.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello, World!", single.String())
+	assert.Nil(t, w.Stats())
+}
+
 func TestStreamWriter(t *testing.T) {
 	tests := []struct {
 		msgs  []string
@@ -164,6 +378,170 @@ func TestStreamWriter(t *testing.T) {
 	}
 }
 
+func TestStreamWriterOrdering(t *testing.T) {
+	const writes = 1000
+
+	uuid := func(p []byte) string {
+		return fmt.Sprintf("ID%03d", len(bytes.TrimSpace(p))%3)
+	}
+
+	for _, o := range []stream.Ordering{stream.OrderPerGroup, stream.OrderGlobal} {
+		buf := &bytes.Buffer{}
+		w := NewStreamWriter(buf, stream.NewFlow(
+			stream.WithExtractor(func(i []byte) (stream.Metadata, []byte) {
+				// uneven processing times reorder unordered stages
+				time.Sleep(time.Duration(len(i)%4) * 50 * time.Microsecond)
+				return stream.Metadata{"uuid": uuid(i)}, i
+			}),
+			stream.WithFilter(func(md stream.Metadata) bool {
+				return true
+			}),
+			stream.WithGrouping(func(md stream.Metadata) string {
+				return md["uuid"]
+			}),
+			stream.WithGroupFilter(func(mds []stream.Metadata) bool {
+				return true
+			}),
+			stream.WithOrdering(o),
+			stream.WithParallelism(8),
+		))
+
+		want := make(map[string][]string)
+		for i := 0; i < writes; i++ {
+			msg := strings.Repeat("a", i%3) + fmt.Sprintf("%d", i)
+			want[uuid([]byte(msg))] = append(want[uuid([]byte(msg))], msg)
+
+			_, err := w.Write([]byte(msg + "\n"))
+			assert.NoError(t, err)
+		}
+
+		err := w.Close()
+		assert.NoError(t, err)
+
+		// the lines of each group are in the order they were written
+		got := make(map[string][]string)
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			got[uuid([]byte(line))] = append(got[uuid([]byte(line))], line)
+		}
+		assert.Equal(t, want, got)
+	}
+}
+
+func TestStreamWriterRecords(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewStreamWriter(buf, stream.NewBasicFlow(
+		nil,
+		func(md stream.Metadata) bool {
+			return md["level"] != "debug"
+		},
+		func(md stream.Metadata) string {
+			return md["uuid"]
+		},
+		func(mds []stream.Metadata) bool {
+			return true
+		},
+	))
+
+	_, err := w.WriteRecord(stream.Metadata{"uuid": "ID001", "level": "debug"}, []byte("debug\n"))
+	assert.NoError(t, err)
+	_, err = w.WriteRecord(stream.Metadata{"uuid": "ID001", "level": "info"}, []byte("info\n"))
+	assert.NoError(t, err)
+	_, err = w.Write([]byte("raw\n"))
+	assert.NoError(t, err)
+
+	err = w.Close()
+	assert.NoError(t, err)
+
+	got := strings.Split(buf.String(), "\n")
+	assert.ElementsMatch(t, []string{"info", "raw", ""}, got)
+}
+
+func TestStreamWriterLineSplitting(t *testing.T) {
+	input := "first\nsecond record\n\nlast, without newline"
+
+	buf := &bytes.Buffer{}
+	w := NewStreamWriterWithOptions(buf, []iostream.WriterOption{iostream.WithLineSplitting()},
+		flow.NewMap(func(i interface{}) interface{} {
+			return append([]byte("|"), i.([]byte)...)
+		}, 1),
+	)
+
+	// a byte at a time, as a worst case of chunked input
+	_, err := io.Copy(w, iotest.OneByteReader(strings.NewReader(input)))
+	assert.NoError(t, err)
+
+	err = w.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "|first\n|second record\n|\n|last, without newline", buf.String())
+}
+
+func TestStreamWriterLineSplittingChunks(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewStreamWriterWithOptions(buf, []iostream.WriterOption{
+		iostream.WithLineSplitting(),
+		iostream.WithMaxLineSize(8),
+	},
+		flow.NewMap(func(i interface{}) interface{} {
+			return append([]byte("|"), i.([]byte)...)
+		}, 1),
+	)
+
+	for _, chunk := range []string{"a\nb", "c\nd\ne", "f\n", "0123", "456789", "\n"} {
+		_, err := w.Write([]byte(chunk))
+		assert.NoError(t, err)
+	}
+
+	err := w.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "|a\n|bc\n|d\n|ef\n|0123456789|\n", buf.String())
+}
+
+func TestStreamWriterRouting(t *testing.T) {
+	msgs := []string{
+		`{"level":"info","msg":"request"}`,
+		`{"level":"error","msg":"error occurred"}`,
+		`{"level":"audit","msg":"user created"}`,
+		`{"level":"debug","msg":"request"}`,
+	}
+
+	buf := &bytes.Buffer{}
+	errBuf := &bytes.Buffer{}
+	auditBuf := &bytes.Buffer{}
+	errSink := stream.NewWriterSink(errBuf)
+	auditSink := stream.NewWriterSink(auditBuf)
+
+	router := stream.NewRouter(
+		func(i []byte) (stream.Metadata, []byte) {
+			var obj map[string]string
+			_ = json.Unmarshal(i, &obj)
+
+			return stream.Metadata{"level": obj["level"]}, i
+		},
+		func(md stream.Metadata) string {
+			return md["level"]
+		},
+		map[string]streams.Inlet{
+			"error": errSink,
+			"audit": auditSink,
+		},
+	)
+	w := NewStreamWriter(buf, router)
+
+	for _, msg := range msgs {
+		_, err := w.Write([]byte(msg + "\n"))
+		assert.NoError(t, err)
+	}
+
+	err := w.Close()
+	assert.NoError(t, err)
+	<-errSink.Done()
+	<-auditSink.Done()
+
+	assert.Equal(t, msgs[0]+"\n"+msgs[3]+"\n", buf.String())
+	assert.Equal(t, msgs[1]+"\n", errBuf.String())
+	assert.Equal(t, msgs[2]+"\n", auditBuf.String())
+}
+
 func TestWriterConcurrent(t *testing.T) {
 	const msgFormat = "Hello World, %d\n"
 	const writes = 1000
@@ -223,6 +601,396 @@ func TestWriterConcurrent(t *testing.T) {
 	}
 }
 
+func TestMultiWriter(t *testing.T) {
+	tests := []struct {
+		wrap func(w io.Writer) io.WriteCloser
+	}{
+		{wrap: func(w io.Writer) io.WriteCloser { return NewBundlerWriter(w) }},
+		{wrap: func(w io.Writer) io.WriteCloser { return NewDiodeWriter(w, 1000, 0, func(missed int) {}) }},
+	}
+
+	for _, tt := range tests {
+		buf1 := &bytes.Buffer{}
+		buf2 := &bytes.Buffer{}
+		w := NewMultiWriter(tt.wrap, buf1, buf2)
+
+		_, err := w.Write([]byte("Hello, World!"))
+		assert.NoError(t, err)
+
+		err = w.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, "Hello, World!", buf1.String())
+		assert.Equal(t, "Hello, World!", buf2.String())
+	}
+}
+
+func TestFailoverWriter(t *testing.T) {
+	primary := &flakyWriter{failures: 2}
+	secondary := &bytes.Buffer{}
+	w := NewFailoverWriter(primary, secondary,
+		failover.WithMaxFailures(2),
+		failover.WithProbeInterval(10*time.Millisecond),
+	)
+
+	for _, msg := range []string{"1", "2"} {
+		_, err := w.Write([]byte(msg))
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, failover.Secondary, w.Stats().Active)
+
+	// the first record after a probe interval is sent to the primary sink
+	assert.Eventually(t, func() bool {
+		_, err := w.Write([]byte("3"))
+		assert.NoError(t, err)
+		return w.Stats().Active == failover.Primary
+	}, time.Second, 5*time.Millisecond)
+
+	err := w.Close()
+	assert.NoError(t, err)
+	err = w.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "3", primary.String())
+	assert.Equal(t, "12", strings.TrimRight(secondary.String(), "3"))
+	assert.Equal(t, uint64(1), w.Stats().Failovers)
+	assert.Equal(t, uint64(1), w.Stats().Failbacks)
+}
+
+func TestFailoverWriterSlowProbe(t *testing.T) {
+	var probes int64
+	primary := &flakyWriter{failures: 1}
+	secondary := &bytes.Buffer{}
+	w := NewFailoverWriter(primary, secondary,
+		failover.WithMaxFailures(1),
+		failover.WithLatencyThreshold(5*time.Millisecond),
+		failover.WithProbeInterval(10*time.Millisecond),
+		failover.WithProbe(func(io.Writer) error {
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt64(&probes, 1)
+			return nil
+		}),
+	)
+
+	_, err := w.Write([]byte("1"))
+	assert.NoError(t, err)
+
+	// the second probe only starts once the first one was handled
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt64(&probes) >= 2
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, failover.Secondary, w.Stats().Active)
+	assert.Equal(t, uint64(0), w.Stats().Failbacks)
+
+	err = w.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "1", secondary.String())
+}
+
+func TestRetryWriter(t *testing.T) {
+	tests := []struct {
+		failures   int
+		want       string
+		deadLetter string
+	}{
+		{failures: 0, want: "Hello, World!", deadLetter: ""},
+		{failures: 2, want: "Hello, World!", deadLetter: ""},
+		{failures: 3, want: "", deadLetter: "Hello, World!"},
+	}
+
+	p := rtx.DefaultPolicy()
+	p.InitialBackoff = time.Millisecond
+
+	for _, tt := range tests {
+		buf := &flakyWriter{failures: tt.failures}
+		dl := &bytes.Buffer{}
+		w := NewBundlerWriter(NewRetryWriter(buf, p, dl))
+
+		_, err := w.Write([]byte("Hello, World!"))
+		assert.NoError(t, err)
+
+		err = w.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, buf.String())
+		assert.Equal(t, tt.deadLetter, dl.String())
+	}
+}
+
+func TestRetryWriterShortWrite(t *testing.T) {
+	p := rtx.DefaultPolicy()
+	p.InitialBackoff = time.Millisecond
+
+	// the sink accepts part of the record before failing
+	buf := &shortWriter{limits: []int{5, 0}}
+	dl := &bytes.Buffer{}
+	w := NewRetryWriter(buf, p, dl)
+
+	n, err := w.Write([]byte("Hello, World!"))
+	assert.NoError(t, err)
+	assert.Equal(t, 13, n)
+	assert.Equal(t, "Hello, World!", buf.String())
+	assert.Equal(t, "", dl.String())
+}
+
+func TestSpillWriter(t *testing.T) {
+	dir := t.TempDir()
+	msgs := []string{"1\n", "2\n", "3\n", "4\n"}
+
+	// the first process fails to deliver anything
+	buf := &flakyWriter{failures: len(msgs) * 10}
+	w, err := NewSpillWriter(buf, dir)
+	assert.NoError(t, err)
+
+	for _, msg := range msgs {
+		_, err = w.Write([]byte(msg))
+		assert.NoError(t, err)
+	}
+	err = w.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "", buf.String())
+
+	// the next process replays the spilled records in order
+	buf = &flakyWriter{failures: 1}
+	w, err = NewSpillWriter(buf, dir, spill.WithReplayInterval(10*time.Millisecond))
+	assert.NoError(t, err)
+
+	_, err = w.Write([]byte("5\n"))
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		return w.Pending() == 0
+	}, time.Second, 10*time.Millisecond)
+
+	err = w.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "1\n2\n3\n4\n5\n", buf.String())
+}
+
+func TestShedWriter(t *testing.T) {
+	buf := &pressureWriter{}
+	w := NewShedWriter(buf)
+
+	write := func(level string) {
+		_, err := w.Write([]byte(fmt.Sprintf(`{"level":"%s"}`, level) + "\n"))
+		assert.NoError(t, err)
+	}
+
+	steps := []struct {
+		pressure float64
+		want     []string
+	}{
+		{pressure: 0.1, want: nil},
+		{pressure: 0.6, want: []string{"debug"}},
+		{pressure: 0.9, want: []string{"debug", "info"}},
+		// within the hysteresis of info
+		{pressure: 0.7, want: []string{"debug", "info"}},
+		{pressure: 0.5, want: []string{"debug"}},
+		{pressure: 0.2, want: nil},
+	}
+
+	for _, s := range steps {
+		buf.pressure = s.pressure
+		for _, level := range []string{"debug", "info", "error"} {
+			write(level)
+		}
+		assert.Equal(t, s.want, w.Stats().Shedding)
+	}
+
+	stats := w.Stats()
+	assert.Equal(t, uint64(4), stats.Dropped["debug"])
+	assert.Equal(t, uint64(2), stats.Dropped["info"])
+	assert.Equal(t, 6, strings.Count(buf.String(), "error"))
+}
+
+func TestJSONLevel(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: `{"level":"INFO","msg":"hello"}`, want: "info"},
+		{input: `{"msg":"hello", "level" : "warn"}`, want: "warn"},
+		{input: `{"req":{"level":"debug"},"level":"error"}`, want: "error"},
+		{input: `{"req":{"level":"debug"},"msg":"hello"}`, want: ""},
+		{input: `{"msg":"\"level\":\"debug\"","tags":["level"]}`, want: ""},
+		{input: `{"level":3}`, want: ""},
+		{input: `not json`, want: ""},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, shed.JSONLevel([]byte(tt.input)), tt.input)
+	}
+}
+
+func TestRedactWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewBundlerWriter(NewRedactWriter(buf,
+		stream.WithRedactKey("password", stream.RedactRemove),
+		stream.WithRedactPattern(stream.EmailPattern, stream.RedactMask),
+	))
+
+	_, err := w.Write([]byte(`{"msg":"signup a@b.co","password":"hunter2"}` + "\n"))
+	assert.NoError(t, err)
+
+	err = w.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"msg":"signup [REDACTED]"}`+"\n", buf.String())
+}
+
+func TestFrameWriter(t *testing.T) {
+	tests := []struct {
+		opts  []frame.WriterOption
+		input string
+		want  string
+	}{
+		{opts: nil, input: "Hello", want: "Hello\n"},
+		{opts: nil, input: "Hello\n", want: "Hello\n"},
+		{
+			opts:  []frame.WriterOption{frame.WithLengthPrefix(true)},
+			input: "Hello",
+			want:  "\x00\x00\x00\x06Hello\n",
+		},
+		{
+			opts:  []frame.WriterOption{frame.WithMaxRecordSize(10), frame.WithTruncateMarker("...")},
+			input: "Hello, World!\n",
+			want:  "Hello, ...\n",
+		},
+		{
+			opts:  []frame.WriterOption{frame.WithMaxRecordSize(10), frame.WithOversizePolicy(frame.Drop)},
+			input: "Hello, World!",
+			want:  "",
+		},
+	}
+
+	for _, tt := range tests {
+		buf := &bytes.Buffer{}
+		w := NewFrameWriter(buf, tt.opts...)
+
+		n, err := w.Write([]byte(tt.input))
+		assert.NoError(t, err)
+		assert.Equal(t, len(tt.input), n)
+		assert.Equal(t, tt.want, buf.String())
+	}
+}
+
+func TestPriorityWriter(t *testing.T) {
+	buf := &gateWriter{started: make(chan struct{}), release: make(chan struct{})}
+	w := NewPriorityWriter(buf, priority.WithLanes(
+		priority.Lane{Name: "high", Levels: []string{"error"}, Capacity: 5, Weight: 8},
+		priority.Lane{Name: "low", Capacity: 2, Weight: 1, Overflow: priority.DropOldest},
+	))
+
+	// the sink blocks on the first record while the others are queued
+	_, _ = w.Write([]byte(`{"level":"debug","n":0}` + "\n"))
+	<-buf.started
+
+	for i := 1; i <= 5; i++ {
+		_, _ = w.Write([]byte(fmt.Sprintf(`{"level":"debug","n":%d}`, i) + "\n"))
+	}
+	for i := 1; i <= 3; i++ {
+		_, _ = w.WriteRecord(stream.Metadata{"level": "error"}, []byte(fmt.Sprintf(`{"n":%d}`, i)+"\n"))
+	}
+
+	stats := w.Stats()
+	assert.Equal(t, priority.Stats{Queued: 3}, stats["high"])
+	assert.Equal(t, priority.Stats{Queued: 2, Dropped: 3}, stats["low"])
+
+	close(buf.release)
+	err := w.Close()
+	assert.NoError(t, err)
+
+	want := []string{
+		`{"level":"debug","n":0}`,
+		`{"n":1}`, `{"n":2}`, `{"n":3}`,
+		`{"level":"debug","n":4}`,
+		`{"level":"debug","n":5}`,
+	}
+	assert.Equal(t, strings.Join(want, "\n")+"\n", buf.String())
+}
+
+func TestPriorityWriterDefaults(t *testing.T) {
+	var errs int64
+	buf := &flakyWriter{failures: 1}
+	w := NewPriorityWriter(buf,
+		priority.WithLanes(),
+		priority.WithOnError(func(err error) {
+			atomic.AddInt64(&errs, 1)
+		}),
+	)
+
+	for _, level := range []string{"error", "debug"} {
+		_, err := w.Write([]byte(`{"level":"` + level + `"}` + "\n"))
+		assert.NoError(t, err)
+	}
+
+	stats := w.Stats()
+	assert.Len(t, stats, len(priority.DefaultLanes))
+
+	err := w.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), atomic.LoadInt64(&errs))
+	assert.Equal(t, `{"level":"debug"}`+"\n", buf.String())
+}
+
+// gateWriter is a bytes.Buffer whose first write waits for release.
+type gateWriter struct {
+	bytes.Buffer
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (g *gateWriter) Write(p []byte) (n int, err error) {
+	g.once.Do(func() {
+		close(g.started)
+		<-g.release
+	})
+	return g.Buffer.Write(p)
+}
+
+// shortWriter is a bytes.Buffer accepting at most limits[i] bytes on the i-th
+// write before failing, then everything.
+type shortWriter struct {
+	bytes.Buffer
+	limits []int
+}
+
+func (s *shortWriter) Write(p []byte) (n int, err error) {
+	if len(s.limits) == 0 {
+		return s.Buffer.Write(p)
+	}
+
+	limit := s.limits[0]
+	s.limits = s.limits[1:]
+	if limit > len(p) {
+		limit = len(p)
+	}
+	n, _ = s.Buffer.Write(p[:limit])
+
+	return n, errors.New("short write")
+}
+
+// pressureWriter is a bytes.Buffer reporting a fixed backpressure.
+type pressureWriter struct {
+	bytes.Buffer
+	pressure float64
+}
+
+func (p *pressureWriter) Backpressure() float64 {
+	return p.pressure
+}
+
+// flakyWriter is a bytes.Buffer failing the first n writes.
+type flakyWriter struct {
+	bytes.Buffer
+	failures int
+}
+
+func (f *flakyWriter) Write(p []byte) (n int, err error) {
+	if f.failures > 0 {
+		f.failures--
+		return 0, errors.New("temporary failure")
+	}
+	return f.Buffer.Write(p)
+}
+
 // Buffer is a goroutine safe bytes.Buffer
 type syncBuffer struct {
 	buffer bytes.Buffer